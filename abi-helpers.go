@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+)
+
+// splitTypeList splits comma separated list of types, nested brackets are respected
+func splitTypeList(list string) []string {
+	var result []string
+	depth, start := 0, 0
+	for i, c := range list {
+		switch c {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				result = append(result, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if rest := strings.TrimSpace(list[start:]); rest != "" {
+		result = append(result, rest)
+	}
+	return result
+}
+
+// parseMethodSignature parses human-readable signatures like "getValidatorStatus(address)(address,uint8,uint256)",
+// output types are optional and might be omitted for the calls where result is not important
+func parseMethodSignature(signature string) (abi.Method, error) {
+	signature = strings.TrimSpace(signature)
+	open := strings.Index(signature, "(")
+	if open <= 0 {
+		return abi.Method{}, fmt.Errorf("bad method signature: %s", signature)
+	}
+	name := signature[:open]
+	var lists []string
+	depth, start := 0, open
+	for i := open; i < len(signature); i++ {
+		switch signature[i] {
+		case '(':
+			if depth == 0 {
+				start = i + 1
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				lists = append(lists, signature[start:i])
+			}
+		}
+	}
+	if depth != 0 || len(lists) == 0 || len(lists) > 2 {
+		return abi.Method{}, fmt.Errorf("bad method signature: %s", signature)
+	}
+	var typeLists [2][]string
+	for i, list := range lists {
+		typeLists[i] = splitTypeList(list)
+		for _, typeName := range typeLists[i] {
+			if strings.HasPrefix(typeName, "(") {
+				return abi.Method{}, fmt.Errorf("tuples are not supported in method signature: %s", signature)
+			}
+		}
+	}
+	var inputs, outputs abi.Arguments
+	if err := safeNewArguments(&inputs, typeLists[0]...); err != nil {
+		return abi.Method{}, err
+	}
+	if err := safeNewArguments(&outputs, typeLists[1]...); err != nil {
+		return abi.Method{}, err
+	}
+	return abi.NewMethod(name, name, abi.Function, "", false, false, inputs, outputs), nil
+}
+
+// safeNewArguments works like newArguments, but returns an error instead of panic (types are user-defined here)
+func safeNewArguments(args *abi.Arguments, typeNames ...string) error {
+	for i, tn := range typeNames {
+		abiType, err := abi.NewType(tn, tn, nil)
+		if err != nil {
+			return fmt.Errorf("bad abi type (%s): %w", tn, err)
+		}
+		*args = append(*args, abi.Argument{Name: fmt.Sprintf("%d", i), Type: abiType})
+	}
+	return nil
+}
+
+// decodeArgument converts JSON value from the config into the Go type expected by the ABI packer
+func decodeArgument(t abi.Type, raw json.RawMessage) (interface{}, error) {
+	switch t.T {
+	case abi.AddressTy:
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil || !common.IsHexAddress(value) {
+			return nil, fmt.Errorf("bad address value: %s", string(raw))
+		}
+		return common.HexToAddress(value), nil
+	case abi.UintTy, abi.IntTy:
+		text := string(raw)
+		var value string
+		if err := json.Unmarshal(raw, &value); err == nil {
+			text = value
+		}
+		number, ok := math.ParseBig256(text)
+		if !ok {
+			return nil, fmt.Errorf("bad number value: %s", string(raw))
+		}
+		// values are checked against the type range, otherwise they are silently truncated by the packer
+		if t.T == abi.UintTy && (number.Sign() < 0 || number.BitLen() > t.Size) {
+			return nil, fmt.Errorf("value is out of uint%d range: %s", t.Size, string(raw))
+		}
+		if t.T == abi.IntTy {
+			limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1))
+			if number.Cmp(limit) >= 0 || number.Cmp(new(big.Int).Neg(limit)) < 0 {
+				return nil, fmt.Errorf("value is out of int%d range: %s", t.Size, string(raw))
+			}
+		}
+		if t.Size > 64 {
+			return number, nil
+		}
+		if t.T == abi.UintTy {
+			return reflect.ValueOf(number.Uint64()).Convert(t.GetType()).Interface(), nil
+		}
+		return reflect.ValueOf(number.Int64()).Convert(t.GetType()).Interface(), nil
+	case abi.BoolTy:
+		var value bool
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("bad bool value: %s", string(raw))
+		}
+		return value, nil
+	case abi.StringTy:
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("bad string value: %s", string(raw))
+		}
+		return value, nil
+	case abi.BytesTy:
+		var value hexutil.Bytes
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("bad bytes value: %s", string(raw))
+		}
+		return []byte(value), nil
+	case abi.FixedBytesTy:
+		var value hexutil.Bytes
+		if err := json.Unmarshal(raw, &value); err != nil || len(value) != t.Size {
+			return nil, fmt.Errorf("bad bytes%d value: %s", t.Size, string(raw))
+		}
+		result := reflect.New(t.GetType()).Elem()
+		reflect.Copy(result, reflect.ValueOf(value))
+		return result.Interface(), nil
+	case abi.SliceTy, abi.ArrayTy:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, fmt.Errorf("bad array value: %s", string(raw))
+		}
+		var result reflect.Value
+		if t.T == abi.SliceTy {
+			result = reflect.MakeSlice(t.GetType(), len(items), len(items))
+		} else if len(items) != t.Size {
+			return nil, fmt.Errorf("array length mismatch, expected %d: %s", t.Size, string(raw))
+		} else {
+			result = reflect.New(t.GetType()).Elem()
+		}
+		for i, item := range items {
+			value, err := decodeArgument(*t.Elem, item)
+			if err != nil {
+				return nil, err
+			}
+			result.Index(i).Set(reflect.ValueOf(value))
+		}
+		return result.Interface(), nil
+	}
+	return nil, fmt.Errorf("abi type is not supported: %s", t.String())
+}
+
+// decodeArguments decodes list of JSON values using provided argument types
+func decodeArguments(args abi.Arguments, values []json.RawMessage) ([]interface{}, error) {
+	if len(args) != len(values) {
+		return nil, fmt.Errorf("arguments count mismatch, expected %d, got %d", len(args), len(values))
+	}
+	var result []interface{}
+	for i, arg := range args {
+		value, err := decodeArgument(arg.Type, values[i])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return result, nil
+}
+
+// packMethodCall encodes call data for the human-readable method signature with JSON arguments
+func packMethodCall(signature string, values []json.RawMessage) (abi.Method, []byte, error) {
+	method, err := parseMethodSignature(signature)
+	if err != nil {
+		return method, nil, err
+	}
+	args, err := decodeArguments(method.Inputs, values)
+	if err != nil {
+		return method, nil, fmt.Errorf("%s: %w", signature, err)
+	}
+	input, err := method.Inputs.Pack(args...)
+	if err != nil {
+		return method, nil, fmt.Errorf("%s: %w", signature, err)
+	}
+	return method, append(method.ID, input...), nil
+}
+
+// formatValues makes string representation of unpacked values, it's used to compare results
+func formatValues(values []interface{}) string {
+	var result []string
+	for _, v := range values {
+		switch value := v.(type) {
+		case *big.Int:
+			result = append(result, value.String())
+		case common.Address:
+			result = append(result, value.Hex())
+		case []byte:
+			result = append(result, hexutil.Encode(value))
+		default:
+			result = append(result, fmt.Sprintf("%v", value))
+		}
+	}
+	return strings.Join(result, ", ")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestParseMethodSignature(t *testing.T) {
+	method, err := parseMethodSignature("getValidatorStatus(address)(address,uint8,uint256[])")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method.Sig != "getValidatorStatus(address)" || len(method.Inputs) != 1 || len(method.Outputs) != 3 {
+		t.Fatalf("bad method: %s inputs=%d outputs=%d", method.Sig, len(method.Inputs), len(method.Outputs))
+	}
+	if method, err = parseMethodSignature("updateDistributionShare(address[], uint16[])"); err != nil {
+		t.Fatal(err)
+	} else if method.Sig != "updateDistributionShare(address[],uint16[])" {
+		t.Fatalf("bad signature: %s", method.Sig)
+	}
+	for signature, expected := range map[string]string{
+		"transfer":                           "bad method signature",
+		"(address)":                          "bad method signature",
+		"transfer(address,uint256":           "bad method signature",
+		"transfer(address)(bool)(bool)":      "bad method signature",
+		"transfer((address,uint256))":        "tuples are not supported",
+		"transfer(address,(uint256,bool)[])": "tuples are not supported",
+		"transfer(account)":                  "bad abi type",
+	} {
+		if _, err := parseMethodSignature(signature); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("%s: expected %q error, got %v", signature, expected, err)
+		}
+	}
+}
+
+func TestDecodeArgument(t *testing.T) {
+	address := common.HexToAddress("0x08fae3885e299c24ff9841478eb946f41023ac69")
+	for _, test := range []struct {
+		typeName string
+		raw      string
+		expected interface{}
+		err      string
+	}{
+		{typeName: "uint8", raw: `255`, expected: uint8(255)},
+		{typeName: "uint8", raw: `"0xff"`, expected: uint8(255)},
+		{typeName: "uint8", raw: `256`, err: "out of uint8 range"},
+		{typeName: "uint32", raw: `-1`, err: "out of uint32 range"},
+		{typeName: "uint64", raw: `"18446744073709551616"`, err: "out of uint64 range"},
+		{typeName: "uint256", raw: `"0x56bc75e2d63100000"`, expected: hexutil.MustDecodeBig("0x56bc75e2d63100000")},
+		{typeName: "int8", raw: `-128`, expected: int8(-128)},
+		{typeName: "int8", raw: `127`, expected: int8(127)},
+		{typeName: "int8", raw: `128`, err: "out of int8 range"},
+		{typeName: "int8", raw: `-129`, err: "out of int8 range"},
+		{typeName: "uint16", raw: `"abc"`, err: "bad number value"},
+		{typeName: "address", raw: `"0x08fae3885e299c24ff9841478eb946f41023ac69"`, expected: address},
+		{typeName: "address", raw: `"0x08fae3885e299c24ff9841478eb946f41023ac"`, err: "bad address value"},
+		{typeName: "address", raw: `1`, err: "bad address value"},
+		{typeName: "bool", raw: `true`, expected: true},
+		{typeName: "string", raw: `"hello"`, expected: "hello"},
+		{typeName: "bytes", raw: `"0xdeadbeef"`, expected: []byte{0xde, 0xad, 0xbe, 0xef}},
+		{typeName: "bytes4", raw: `"0xdeadbeef"`, expected: [4]byte{0xde, 0xad, 0xbe, 0xef}},
+		{typeName: "bytes4", raw: `"0xdeadbe"`, err: "bad bytes4 value"},
+		{typeName: "bytes32", raw: `"0xdeadbeef"`, err: "bad bytes32 value"},
+		{typeName: "address[]", raw: `["0x08fae3885e299c24ff9841478eb946f41023ac69"]`, expected: []common.Address{address}},
+		{typeName: "uint16[]", raw: `[1, "0x2"]`, expected: []uint16{1, 2}},
+		{typeName: "uint16[]", raw: `[1, 65536]`, err: "out of uint16 range"},
+		{typeName: "uint8[2]", raw: `[1, 2]`, expected: [2]uint8{1, 2}},
+		{typeName: "uint8[2]", raw: `[1]`, err: "array length mismatch"},
+		{typeName: "uint8[]", raw: `1`, err: "bad array value"},
+	} {
+		abiType, err := abi.NewType(test.typeName, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := decodeArgument(abiType, json.RawMessage(test.raw))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("%s %s: expected %q error, got %v", test.typeName, test.raw, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s %s: %v", test.typeName, test.raw, err)
+		}
+		if !reflect.DeepEqual(value, test.expected) {
+			t.Fatalf("%s %s: expected %v (%T), got %v (%T)", test.typeName, test.raw, test.expected, test.expected, value, value)
+		}
+		// decoded value must be accepted by the packer
+		if _, err := (abi.Arguments{{Type: abiType}}).Pack(value); err != nil {
+			t.Fatalf("%s %s: %v", test.typeName, test.raw, err)
+		}
+	}
+}
+
+func TestDecodeArgumentTupleNotSupported(t *testing.T) {
+	tupleType, err := abi.NewType("tuple", "", []abi.ArgumentMarshaling{{Name: "account", Type: "address"}, {Name: "share", Type: "uint16"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeArgument(tupleType, json.RawMessage(`["0x08fae3885e299c24ff9841478eb946f41023ac69", 1]`)); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("expected not supported error, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+)
+
+// rawAllocAccount is a full genesis account (multisigs, contracts with pre-computed storage etc), code can be
+// provided as hex string or as a path to the file with hex string or raw bytecode
+type rawAllocAccount struct {
+	Code     hexutil.Bytes               `json:"code"`
+	CodeFile string                      `json:"codeFile"`
+	Storage  map[common.Hash]common.Hash `json:"storage"`
+	Balance  *math.HexOrDecimal256       `json:"balance"`
+	Nonce    math.HexOrDecimal64         `json:"nonce"`
+}
+
+// readCodeFile reads code in the format defined by the file extension, content isn't sniffed because raw
+// bytecode can consist of hex digits only. Hex files might not have 0x prefix (solc --bin output doesn't have it)
+func readCodeFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hex", ".bin", ".bin-runtime":
+		text := strings.TrimSpace(string(data))
+		if strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X") {
+			text = text[2:]
+		}
+		code, err := hex.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("bad hex code: %w", err)
+		}
+		return code, nil
+	case ".raw":
+		return data, nil
+	}
+	return nil, fmt.Errorf("unknown code file format (%s), use .hex, .bin or .bin-runtime for hex and .raw for raw bytecode", path)
+}
+
+func (a *rawAllocAccount) toGenesisAccount() (core.GenesisAccount, error) {
+	if len(a.Code) > 0 && a.CodeFile != "" {
+		return core.GenesisAccount{}, fmt.Errorf("either code or code file must be specified")
+	}
+	code := []byte(a.Code)
+	if a.CodeFile != "" {
+		var err error
+		if code, err = readCodeFile(a.CodeFile); err != nil {
+			return core.GenesisAccount{}, fmt.Errorf("failed to read code file: %w", err)
+		}
+	}
+	if len(a.Storage) > 0 && len(code) == 0 {
+		return core.GenesisAccount{}, fmt.Errorf("storage can't be set for account without code")
+	}
+	balance := big.NewInt(0)
+	if a.Balance != nil {
+		balance = (*big.Int)(a.Balance)
+	}
+	account := core.GenesisAccount{
+		Balance: balance,
+		Nonce:   uint64(a.Nonce),
+	}
+	if len(code) > 0 {
+		account.Code = code
+	}
+	if len(a.Storage) > 0 {
+		account.Storage = a.Storage
+	}
+	return account, nil
+}
+
+// applyRawAlloc adds raw accounts to the genesis allocation, accounts are applied in the address order to make
+// error messages stable
+func applyRawAlloc(genesis *core.Genesis, rawAlloc map[common.Address]rawAllocAccount, silent bool) error {
+	var addresses []common.Address
+	for address := range rawAlloc {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i].Bytes(), addresses[j].Bytes()) < 0
+	})
+	for _, address := range addresses {
+		raw := rawAlloc[address]
+		account, err := raw.toGenesisAccount()
+		if err != nil {
+			return fmt.Errorf("raw alloc (%s): %w", address.Hex(), err)
+		}
+		if err := checkAllocConflict(genesis, address, "raw alloc"); err != nil {
+			return err
+		}
+		genesis.Alloc[address] = account
+		if !silent {
+			fmt.Printf(" + raw alloc: address=%s balance=%s nonce=%d code size=%d storage slots=%d\n", address.Hex(), account.Balance, account.Nonce, len(account.Code), len(account.Storage))
+		}
+	}
+	return nil
+}
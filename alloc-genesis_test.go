@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadCodeFile(t *testing.T) {
+	dir := t.TempDir()
+	code := []byte{0x60, 0x80, 0x60, 0x40, 0x52}
+	for _, test := range []struct {
+		name     string
+		content  string
+		expected []byte
+		err      string
+	}{
+		{name: "code.hex", content: "0x6080604052\n", expected: code},
+		{name: "code.HEX", content: "0X6080604052", expected: code},
+		{name: "Contract.bin", content: "6080604052", expected: code},
+		{name: "Contract.bin-runtime", content: " 6080604052 \n", expected: code},
+		{name: "odd.hex", content: "0x608060405", err: "bad hex code"},
+		{name: "bad.hex", content: "0x60806040zz", err: "bad hex code"},
+		{name: "empty.hex", content: "", expected: []byte{}},
+		// raw bytecode that consists of hex digits only is kept as is
+		{name: "digits.raw", content: "6080604052", expected: []byte("6080604052")},
+		{name: "code.raw", content: string(code), expected: code},
+		{name: "code.txt", content: "0x6080604052", err: "unknown code file format"},
+		{name: "code", content: "0x6080604052", err: "unknown code file format"},
+	} {
+		path := filepath.Join(dir, test.name)
+		if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		result, err := readCodeFile(path)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("%s: expected %q error, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !bytes.Equal(result, test.expected) {
+			t.Fatalf("%s: expected %x, got %x", test.name, test.expected, result)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/systemcontracts"
+)
+
+//go:embed build/contracts/FakeSystemReward.json
+var fakeSystemRewardRawArtifact []byte
+
+//go:embed build/contracts/FakeRuntimeUpgrade.json
+var fakeRuntimeUpgradeRawArtifact []byte
+
+//go:embed build/contracts/FakeRuntimeUpgradeEvmHook.json
+var fakeRuntimeUpgradeEvmHookRawArtifact []byte
+
+//go:embed build/contracts/FakeDeployerProxy.json
+var fakeDeployerProxyRawArtifact []byte
+
+// artifactOverrides is a list of contract artifacts passed with --artifact flag (Contract=path/to/artifact.json)
+type artifactOverrides map[string]string
+
+func (o artifactOverrides) String() string {
+	var result []string
+	for name, path := range o {
+		result = append(result, fmt.Sprintf("%s=%s", name, path))
+	}
+	sort.Strings(result)
+	return strings.Join(result, ",")
+}
+
+func (o artifactOverrides) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("artifact override must be in the format Contract=path/to/artifact.json")
+	}
+	o[parts[0]] = parts[1]
+	return nil
+}
+
+// systemArtifacts are artifacts of the contracts deployed at system addresses, by default these are production
+// contracts, but test mode and artifact overrides can replace them
+type systemArtifacts struct {
+	Staking           []byte
+	StakingPool       []byte
+	ChainConfig       []byte
+	SlashingIndicator []byte
+	SystemReward      []byte
+	Governance        []byte
+	RuntimeUpgrade    []byte
+	DeployerProxy     []byte
+	// contract placed at the EVM hook address, it's empty for production builds
+	RuntimeUpgradeEvmHook []byte
+}
+
+func loadSystemArtifacts(opts buildOptions) (*systemArtifacts, error) {
+	artifacts := &systemArtifacts{
+		Staking:           stakingRawArtifact,
+		StakingPool:       stakingPoolRawArtifact,
+		ChainConfig:       chainConfigRawArtifact,
+		SlashingIndicator: slashingIndicatorRawArtifact,
+		SystemReward:      systemRewardRawArtifact,
+		Governance:        governanceRawArtifact,
+		RuntimeUpgrade:    runtimeUpgradeRawArtifact,
+		DeployerProxy:     deployerProxyRawArtifact,
+	}
+	// fake contracts relax governance rules (anyone can update shares, deployers and upgrade system contracts)
+	if opts.TestMode {
+		artifacts.SystemReward = fakeSystemRewardRawArtifact
+		artifacts.RuntimeUpgrade = fakeRuntimeUpgradeRawArtifact
+		artifacts.DeployerProxy = fakeDeployerProxyRawArtifact
+		artifacts.RuntimeUpgradeEvmHook = fakeRuntimeUpgradeEvmHookRawArtifact
+	}
+	byName := map[string]*[]byte{
+		"Staking":               &artifacts.Staking,
+		"StakingPool":           &artifacts.StakingPool,
+		"ChainConfig":           &artifacts.ChainConfig,
+		"SlashingIndicator":     &artifacts.SlashingIndicator,
+		"SystemReward":          &artifacts.SystemReward,
+		"Governance":            &artifacts.Governance,
+		"RuntimeUpgrade":        &artifacts.RuntimeUpgrade,
+		"DeployerProxy":         &artifacts.DeployerProxy,
+		"RuntimeUpgradeEvmHook": &artifacts.RuntimeUpgradeEvmHook,
+	}
+	for name, path := range opts.ArtifactOverrides {
+		target, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown system contract in artifact override: %s", name)
+		}
+		rawArtifact, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s artifact: %w", name, err)
+		}
+		*target = rawArtifact
+	}
+	return artifacts, nil
+}
+
+// deployRuntimeUpgradeEvmHook places contract at the EVM hook address, with the fake hook upgrades only emit
+// an event instead of replacing the bytecode
+func deployRuntimeUpgradeEvmHook(genesis *core.Genesis, rawArtifact []byte, silent bool, opts buildOptions) (*deploymentStats, error) {
+	address := systemcontracts.EvmHookRuntimeUpgradeAddress
+	if err := checkAllocConflict(genesis, address, "runtime upgrade evm hook"); err != nil {
+		return nil, err
+	}
+	stats, err := simulateContract(genesis, address, common.Address{}, rawArtifact, nil, big.NewInt(0), nil, opts)
+	if err != nil {
+		return stats, err
+	}
+	if !silent {
+		fmt.Printf(" + deployed %s: %s\n", stats.ContractName, stats)
+	}
+	return stats, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/prysmaticlabs/prysm/v4/crypto/bls"
+
+	"create-genesis/extradata"
+)
+
+// readVoteAddress reads BLS public key from hex string or EIP-2335 keystore file (public key is stored
+// unencrypted, so there is no need in password)
+func readVoteAddress(value string) (extradata.VoteAddress, error) {
+	var voteAddress extradata.VoteAddress
+	rawKey := value
+	if !strings.HasPrefix(value, "0x") {
+		fileContents, err := os.ReadFile(value)
+		if err != nil {
+			return voteAddress, err
+		}
+		var keystore struct {
+			Pubkey string `json:"pubkey"`
+		}
+		if err := json.Unmarshal(fileContents, &keystore); err != nil {
+			return voteAddress, fmt.Errorf("failed to parse BLS keystore (%s): %w", value, err)
+		}
+		if keystore.Pubkey == "" {
+			return voteAddress, fmt.Errorf("BLS keystore (%s) doesn't have public key", value)
+		}
+		rawKey = "0x" + strings.TrimPrefix(keystore.Pubkey, "0x")
+	}
+	pubKey, err := hexutil.Decode(rawKey)
+	if err != nil {
+		return voteAddress, err
+	}
+	if len(pubKey) != extradata.VoteAddressLength {
+		return voteAddress, fmt.Errorf("BLS public key must be %d bytes, got %d", extradata.VoteAddressLength, len(pubKey))
+	}
+	// make sure it's a valid point, otherwise votes of this validator can't be verified
+	if _, err := bls.PublicKeyFromBytes(pubKey); err != nil {
+		return voteAddress, fmt.Errorf("bad BLS public key: %w", err)
+	}
+	copy(voteAddress[:], pubKey)
+	return voteAddress, nil
+}
+
+// readVoteAddresses returns vote addresses in the same order as validators, every validator must have the key
+func readVoteAddresses(config genesisConfig) ([]extradata.VoteAddress, error) {
+	validators := make(map[common.Address]bool)
+	var result []extradata.VoteAddress
+	for _, validator := range config.Validators {
+		validators[validator] = true
+		value, ok := config.VoteKeys[validator]
+		if !ok {
+			return nil, fmt.Errorf("vote key is not found for validator: %s", validator.Hex())
+		}
+		voteAddress, err := readVoteAddress(value)
+		if err != nil {
+			return nil, fmt.Errorf("validator (%s) vote key: %w", validator.Hex(), err)
+		}
+		result = append(result, voteAddress)
+	}
+	for validator := range config.VoteKeys {
+		if !validators[validator] {
+			return nil, fmt.Errorf("vote key is set for unknown validator: %s", validator.Hex())
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"unsafe"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// bootstrapCall is a regular contract call executed on top of the initialized genesis state (delegations,
+// proposers, ban lists etc), its state changes are committed into the genesis allocation
+type bootstrapCall struct {
+	From   common.Address        `json:"from"`
+	To     common.Address        `json:"to"`
+	Value  *math.HexOrDecimal256 `json:"value"`
+	Method string                `json:"method"`
+	Args   []json.RawMessage     `json:"args"`
+}
+
+func readStateObjectAddressesFromState(statedb *state.StateDB) []common.Address {
+	rf := reflect.ValueOf(statedb).Elem().FieldByName("stateObjects")
+	rf = reflect.NewAt(rf.Type(), unsafe.Pointer(rf.UnsafeAddr())).Elem()
+	var result []common.Address
+	for _, key := range rf.MapKeys() {
+		result = append(result, key.Interface().(common.Address))
+	}
+	return result
+}
+
+// executeCall runs the call from EOA as a transaction (nonce is increased), but calls from contracts are
+// executed as internal calls (e.g. governance calls can be made on behalf of the governance contract)
+func executeCall(evm *vm.EVM, statedb *state.StateDB, from, to common.Address, value *big.Int, input []byte, gasLimit uint64) (uint64, error) {
+	if statedb.GetCodeSize(from) > 0 {
+		result, leftOverGas, err := evm.Call(vm.AccountRef(from), to, input, gasLimit, value)
+		if err != nil {
+			return gasLimit - leftOverGas, fmt.Errorf("%s", formatCallError(result, err))
+		}
+		return gasLimit - leftOverGas, nil
+	}
+	msg := &core.Message{
+		To:                &to,
+		From:              from,
+		Nonce:             statedb.GetNonce(from),
+		Value:             value,
+		GasLimit:          gasLimit,
+		GasPrice:          big.NewInt(0),
+		GasFeeCap:         big.NewInt(0),
+		GasTipCap:         big.NewInt(0),
+		Data:              input,
+		SkipAccountChecks: false,
+	}
+	evm.Reset(core.NewEVMTxContext(msg), statedb)
+	result, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(gasLimit))
+	if err != nil {
+		return 0, err
+	} else if result.Err != nil {
+		return result.UsedGas, fmt.Errorf("%s", formatCallError(result.Revert(), result.Err))
+	}
+	return result.UsedGas, nil
+}
+
+// commitStateToAlloc writes modified state back to the genesis allocation, all existing accounts are kept
+// and new accounts are added only if they're not empty
+func commitStateToAlloc(genesis *core.Genesis, statedb *state.StateDB) {
+	for _, address := range readStateObjectAddressesFromState(statedb) {
+		storage := make(map[common.Hash]common.Hash)
+		for key, value := range readDirtyStorageFromState(statedb.GetOrNewStateObject(address)) {
+			if value != (common.Hash{}) {
+				storage[key] = value
+			}
+		}
+		_, exists := genesis.Alloc[address]
+		if !exists && statedb.Empty(address) && len(storage) == 0 {
+			continue
+		}
+		account := core.GenesisAccount{
+			Code:    statedb.GetCode(address),
+			Balance: new(big.Int).Set(statedb.GetBalance(address)),
+			Nonce:   statedb.GetNonce(address),
+		}
+		if len(storage) > 0 {
+			account.Storage = storage
+		}
+		genesis.Alloc[address] = account
+	}
+}
+
+// applyBootstrapCalls executes calls in the order they're defined, any revert fails the build (state
+// must be committed into genesis allocation after)
+func applyBootstrapCalls(genesis *core.Genesis, statedb *state.StateDB, evm *vm.EVM, calls []bootstrapCall, silent bool) error {
+	for i, call := range calls {
+		_, input, err := packMethodCall(call.Method, call.Args)
+		if err != nil {
+			return fmt.Errorf("bootstrap call #%d: %w", i, err)
+		}
+		value := big.NewInt(0)
+		if call.Value != nil {
+			value = (*big.Int)(call.Value)
+		}
+		gasUsed, err := executeCall(evm, statedb, call.From, call.To, value, input, genesis.GasLimit)
+		if err != nil {
+			return fmt.Errorf("bootstrap call #%d (%s) from %s to %s failed: %w", i, call.Method, call.From.Hex(), call.To.Hex(), err)
+		}
+		if !silent {
+			fmt.Printf(" + bootstrap call: from=%s to=%s method=%s value=%s gas=%d\n", call.From.Hex(), call.To.Hex(), call.Method, value, gasUsed)
+		}
+	}
+	return nil
+}
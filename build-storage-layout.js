@@ -0,0 +1,78 @@
+const fs = require("fs");
+const os = require("os");
+const path = require("path");
+
+// truffle artifacts don't have storage layout, so system contracts are compiled once again with the same settings
+// by the same compiler, truffle downloads it into its cache on `yarn compile` and nothing else is downloaded here
+const solcVersion = "0.8.17";
+const systemContracts = ["Staking", "SlashingIndicator", "SystemReward", "StakingPool", "Governance", "ChainConfig", "RuntimeUpgrade", "DeployerProxy"];
+const outputPath = path.join(__dirname, "./build/storage");
+
+const readSource = sourcePath => {
+    for (const basePath of [__dirname, path.join(__dirname, "node_modules")]) {
+        const filePath = path.join(basePath, sourcePath);
+        if (fs.existsSync(filePath)) {
+            return fs.readFileSync(filePath, "utf8");
+        }
+    }
+    throw new Error(`file not found: ${sourcePath}`);
+};
+
+// all imports are resolved here, so the standard JSON input is self-contained (no import callback is needed)
+const sources = {};
+const addSource = sourcePath => {
+    if (sources[sourcePath]) {
+        return;
+    }
+    const content = readSource(sourcePath);
+    sources[sourcePath] = {content};
+    for (const [, importPath] of content.matchAll(/import\s+(?:[^"';]*\s+from\s+)?["']([^"']+)["']/g)) {
+        if (importPath.startsWith("./") || importPath.startsWith("../")) {
+            addSource(path.posix.normalize(path.posix.join(path.posix.dirname(sourcePath), importPath)));
+        } else {
+            addSource(importPath);
+        }
+    }
+};
+systemContracts.forEach(contractName => addSource(`contracts/${contractName}.sol`));
+
+// compiler cache of truffle is in its config directory (env-paths of "truffle" with "nodejs" suffix)
+const truffleConfigDir = () => {
+    switch (process.platform) {
+        case "darwin":
+            return path.join(os.homedir(), "Library", "Preferences", "truffle-nodejs");
+        case "win32":
+            return path.join(process.env.APPDATA || path.join(os.homedir(), "AppData", "Roaming"), "truffle-nodejs", "Config");
+        default:
+            return path.join(process.env.XDG_CONFIG_HOME || path.join(os.homedir(), ".config"), "truffle-nodejs");
+    }
+};
+const loadCompiler = () => {
+    const cachePath = path.join(truffleConfigDir(), "compilers", "node_modules");
+    const fileName = fs.existsSync(cachePath) && fs.readdirSync(cachePath).find(name => name.startsWith(`soljson-v${solcVersion}+`) && name.endsWith(".js"));
+    if (!fileName) {
+        throw new Error(`solc ${solcVersion} isn't found in truffle cache (${cachePath}), run yarn compile first`);
+    }
+    // the same entry point solc-js uses for 0.6+ compilers, imports are resolved above, so there is no callback
+    return require(path.join(cachePath, fileName)).cwrap("solidity_compile", "string", ["string", "number", "number"]);
+};
+
+const output = JSON.parse(loadCompiler()(JSON.stringify({
+    language: "Solidity",
+    sources,
+    settings: {
+        optimizer: {enabled: true, runs: 50},
+        outputSelection: {"*": {"*": ["storageLayout"]}},
+    },
+}), 0, 0));
+const errors = (output.errors || []).filter(({severity}) => severity === "error");
+if (errors.length > 0) {
+    errors.forEach(({formattedMessage}) => console.error(formattedMessage));
+    process.exit(1);
+}
+
+fs.mkdirSync(outputPath, {recursive: true});
+systemContracts.forEach(contractName => {
+    const {storageLayout} = output.contracts[`contracts/${contractName}.sol`][contractName];
+    fs.writeFileSync(path.join(outputPath, `${contractName}.json`), JSON.stringify(storageLayout, null, 2));
+});
@@ -3,6 +3,7 @@ package main
 import (
 	_ "embed"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
@@ -10,14 +11,11 @@ import (
 	"os"
 	"reflect"
 	"strings"
-	"unicode"
 	"unsafe"
 
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/core/systemcontracts"
 
-	_ "github.com/ethereum/go-ethereum/eth/tracers/native"
-
 	"github.com/ethereum/go-ethereum/crypto"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
@@ -32,11 +30,32 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb/memorydb"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/trie"
+
+	"create-genesis/extradata"
 )
 
 type artifactData struct {
-	Bytecode         string `json:"bytecode"`
-	DeployedBytecode string `json:"deployedBytecode"`
+	ContractName     string  `json:"contractName"`
+	ABI              abi.ABI `json:"abi"`
+	Bytecode         string  `json:"bytecode"`
+	DeployedBytecode string  `json:"deployedBytecode"`
+}
+
+type buildOptions struct {
+	// directory for the call and prestate traces of system contract deployment (disabled if empty)
+	TraceDir string
+	// gas limit for the system contract create and init calls
+	GasLimit uint64
+	// export events emitted by system contracts create and init calls next to the genesis file
+	ExportEvents bool
+	// replace system contracts with the fakes from contracts/tests (relaxed governance and upgrade rules)
+	TestMode bool
+	// system contract artifacts to use instead of embedded ones, indexed by contract name
+	ArtifactOverrides artifactOverrides
+	// keystore files or directories with validator keys (in addition to the ones referenced by config)
+	KeystorePaths pathList
+	// fail if any validator doesn't have a key in keystore
+	RequireKeys bool
 }
 
 type dummyChainContext struct {
@@ -50,12 +69,25 @@ func (d *dummyChainContext) GetHeader(common.Hash, uint64) *types.Header {
 	return nil
 }
 
-func createExtraData(validators []common.Address) []byte {
-	extra := make([]byte, 32+20*len(validators)+65)
-	for i, v := range validators {
-		copy(extra[32+20*i:], v.Bytes())
+func createExtraData(genesis *core.Genesis, config genesisConfig) ([]byte, error) {
+	// since Luban every validator has BLS vote address for fast finality
+	if genesis.Config.IsLuban(common.Big0) {
+		if config.LegacyValidatorOrder {
+			return nil, fmt.Errorf("legacy validator order is not supported with Luban fork")
+		}
+		voteAddresses, err := readVoteAddresses(config)
+		if err != nil {
+			return nil, err
+		}
+		return extradata.EncodeLuban(config.ExtraVanity, config.Validators, voteAddresses)
+	}
+	if len(config.VoteKeys) > 0 {
+		return nil, fmt.Errorf("vote keys require Luban fork to be active at genesis")
+	}
+	if config.LegacyValidatorOrder {
+		return extradata.EncodeInOrder(config.ExtraVanity, config.Validators)
 	}
-	return extra
+	return extradata.Encode(config.ExtraVanity, config.Validators)
 }
 
 func readDirtyStorageFromState(f interface{}) state.Storage {
@@ -71,28 +103,42 @@ func readDirtyStorageFromState(f interface{}) state.Storage {
 	return result
 }
 
-func simulateSystemContract(genesis *core.Genesis, systemContract common.Address, rawArtifact []byte, constructor []byte, balance *big.Int) error {
+// simulatedCall is a call to the contract that is executed right after its creation
+type simulatedCall struct {
+	Stage string
+	From  common.Address
+	Input []byte
+	// check-only calls don't modify genesis state (e.g. system contracts are initialized by consensus engine),
+	// they must be placed after other calls
+	CheckOnly bool
+}
+
+func simulateContract(genesis *core.Genesis, contract, creator common.Address, rawArtifact []byte, constructor []byte, balance *big.Int, calls []simulatedCall, opts buildOptions) (*deploymentStats, error) {
 	artifact := &artifactData{}
 	if err := json.Unmarshal(rawArtifact, artifact); err != nil {
-		return err
+		return nil, err
 	}
 	bytecode := append(hexutil.MustDecode(artifact.Bytecode), constructor...)
+	stats := &deploymentStats{ContractName: artifact.ContractName, Address: contract, InitCodeSize: len(bytecode)}
+	if len(bytecode) > params.MaxInitCodeSize {
+		return stats, fmt.Errorf("%s init code size is %d bytes, it exceeds EIP-3860 limit of %d bytes", artifact.ContractName, len(bytecode), params.MaxInitCodeSize)
+	}
 	// simulate constructor execution
 	ethdb := rawdb.NewDatabase(memorydb.New())
 	db := state.NewDatabaseWithConfig(ethdb, &trie.Config{})
 	statedb, err := state.New(common.Hash{}, db, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	statedb.SetBalance(systemContract, balance)
+	statedb.SetBalance(contract, balance)
 	block := genesis.ToBlock()
 	blockContext := core.NewEVMBlockContext(block.Header(), &dummyChainContext{}, &common.Address{})
 
 	msg := &core.Message{
 		To:                &common.Address{},
-		From:              systemContract,
+		From:              contract,
 		Value:             big.NewInt(0),
-		GasLimit:          10_000_000,
+		GasLimit:          opts.GasLimit,
 		GasPrice:          big.NewInt(0),
 		GasFeeCap:         big.NewInt(0),
 		GasTipCap:         big.NewInt(0),
@@ -101,44 +147,80 @@ func simulateSystemContract(genesis *core.Genesis, systemContract common.Address
 
 	txContext := core.NewEVMTxContext(msg)
 
+	// each stage is traced separately, so we need new tracer (and EVM) for the create and every call
+	createTracer, err := newSystemContractTracer(opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	evm := vm.NewEVM(blockContext, txContext, statedb, genesis.Config, vm.Config{})
-	deployedBytecode, _, err := evm.CreateWithAddress(vm.AccountRef(common.Address{}), bytecode, 10_000_000, big.NewInt(0), systemContract)
-	if err != nil {
-		for _, c := range deployedBytecode[64:] {
-			if c >= 32 && c <= unicode.MaxASCII {
-				print(string(c))
-			}
-		}
-		println()
-		return err
+	evm := vm.NewEVM(blockContext, txContext, statedb, genesis.Config, newTracedVmConfig(createTracer))
+	if createTracer != nil {
+		createTracer.CaptureTxStart(opts.GasLimit)
 	}
-	storage := readDirtyStorageFromState(statedb.GetOrNewStateObject(systemContract))
-	// read state changes from state database
-	genesisAccount := core.GenesisAccount{
-		Code:    deployedBytecode,
-		Storage: storage.Copy(),
-		Balance: big.NewInt(0),
-		Nonce:   0,
+	deployedBytecode, leftOverGas, err := evm.CreateWithAddress(vm.AccountRef(creator), bytecode, opts.GasLimit, big.NewInt(0), contract)
+	if createTracer != nil {
+		createTracer.CaptureTxEnd(leftOverGas)
 	}
-	if genesis.Alloc == nil {
-		genesis.Alloc = make(core.GenesisAlloc)
+	if traceErr := writeSystemContractTrace(opts, genesis, artifact.ContractName, "create", createTracer); traceErr != nil {
+		return nil, traceErr
 	}
-	genesis.Alloc[systemContract] = genesisAccount
-	// make sure ctor working fine (better to fail here instead of in consensus engine)
-	errorCode, _, err := evm.Call(vm.AccountRef(common.Address{}), systemContract, hexutil.MustDecode("0xe1c7392a"), 10_000_000, big.NewInt(0))
+	stats.CreateGasUsed, stats.CodeSize = opts.GasLimit-leftOverGas, len(deployedBytecode)
 	if err != nil {
-		for _, c := range errorCode[64:] {
-			if c >= 32 && c <= unicode.MaxASCII {
-				print(string(c))
-			}
+		return stats, describeDeploymentError(artifact.ContractName, "constructor", opts.GasLimit, deployedBytecode, err)
+	}
+	stats.Events = decodeGenesisEvents(artifact.ABI, artifact.ContractName, "create", statedb.Logs())
+	// read state changes from state database
+	saveGenesisAccount := func() {
+		storage := readDirtyStorageFromState(statedb.GetOrNewStateObject(contract))
+		genesisAccount := core.GenesisAccount{
+			Code:    deployedBytecode,
+			Storage: storage.Copy(),
+			Balance: big.NewInt(0),
+			Nonce:   0,
 		}
-		println()
-		return err
+		if genesis.Alloc == nil {
+			genesis.Alloc = make(core.GenesisAlloc)
+		}
+		genesis.Alloc[contract] = genesisAccount
 	}
-	return nil
+	saved := false
+	for _, call := range calls {
+		if call.CheckOnly && !saved {
+			saveGenesisAccount()
+			saved = true
+		}
+		callTracer, err := newSystemContractTracer(opts)
+		if err != nil {
+			return nil, err
+		}
+		evm = vm.NewEVM(blockContext, txContext, statedb, genesis.Config, newTracedVmConfig(callTracer))
+		if callTracer != nil {
+			callTracer.CaptureTxStart(opts.GasLimit)
+		}
+		logsBefore := len(statedb.Logs())
+		errorCode, leftOverGas, err := evm.Call(vm.AccountRef(call.From), contract, call.Input, opts.GasLimit, big.NewInt(0))
+		if callTracer != nil {
+			callTracer.CaptureTxEnd(leftOverGas)
+		}
+		if traceErr := writeSystemContractTrace(opts, genesis, artifact.ContractName, call.Stage, callTracer); traceErr != nil {
+			return nil, traceErr
+		}
+		stats.InitGasUsed += opts.GasLimit - leftOverGas
+		if err != nil {
+			return stats, describeDeploymentError(artifact.ContractName, call.Stage, opts.GasLimit, errorCode, err)
+		}
+		stats.Events = append(stats.Events, decodeGenesisEvents(artifact.ABI, artifact.ContractName, call.Stage, statedb.Logs()[logsBefore:])...)
+	}
+	if !saved {
+		saveGenesisAccount()
+	}
+	return stats, nil
+}
+
+func simulateSystemContract(genesis *core.Genesis, systemContract common.Address, rawArtifact []byte, constructor []byte, balance *big.Int, opts buildOptions) (*deploymentStats, error) {
+	// make sure ctor working fine (better to fail here instead of in consensus engine)
+	return simulateContract(genesis, systemContract, common.Address{}, rawArtifact, constructor, balance, []simulatedCall{
+		{Stage: "init", From: common.Address{}, Input: initFunctionSelector, CheckOnly: true},
+	}, opts)
 }
 
 var stakingAddress = common.HexToAddress("0x0000000000000000000000000000000000001000")
@@ -202,22 +284,37 @@ type RTFForks struct {
 	RuntimeUpgradeBlock    *math.HexOrDecimal256 `json:"runtimeUpgradeBlock"`
 	DeployOriginBlock      *math.HexOrDecimal256 `json:"deployOriginBlock"`
 	DeploymentHookFixBlock *math.HexOrDecimal256 `json:"deploymentHookFixBlock"`
+	LubanBlock             *math.HexOrDecimal256 `json:"lubanBlock"`
 }
 
 type genesisConfig struct {
-	ChainId         int64                     `json:"chainId"`
-	Deployers       []common.Address          `json:"deployers"`
-	Validators      []common.Address          `json:"validators"`
-	SystemTreasury  map[common.Address]uint16 `json:"systemTreasury"`
-	ConsensusParams consensusParams           `json:"consensusParams"`
-	VotingPeriod    int64                     `json:"votingPeriod"`
-	Faucet          map[common.Address]string `json:"faucet"`
-	CommissionRate  int64                     `json:"commissionRate"`
-	InitialStakes   map[common.Address]string `json:"initialStakes"`
-	Forks           RTFForks                  `json:"forks"`
+	ChainId         int64                              `json:"chainId"`
+	Deployers       []common.Address                   `json:"deployers"`
+	Validators      []common.Address                   `json:"validators"`
+	SystemTreasury  map[common.Address]uint16          `json:"systemTreasury"`
+	ConsensusParams consensusParams                    `json:"consensusParams"`
+	VotingPeriod    int64                              `json:"votingPeriod"`
+	Faucet          map[common.Address]string          `json:"faucet"`
+	CommissionRate  int64                              `json:"commissionRate"`
+	InitialStakes   map[common.Address]string          `json:"initialStakes"`
+	Forks           RTFForks                           `json:"forks"`
+	Expectations    []genesisExpectation               `json:"expectations"`
+	Bootstrap       []bootstrapCall                    `json:"bootstrap"`
+	Predeploys      []predeployConfig                  `json:"predeploys"`
+	Utilities       utilityPredeploys                  `json:"utilities"`
+	RawAlloc        map[common.Address]rawAllocAccount `json:"rawAlloc"`
+	RTFToken        *rtfTokenConfig                    `json:"rtfToken"`
+	ExtraVanity     hexutil.Bytes                      `json:"extraVanity"`
+	VoteKeys        map[common.Address]string          `json:"voteKeys"`
+	Keystores       keystoreReferences                 `json:"keystores"`
+	Mnemonic        *mnemonicAccounts                  `json:"mnemonic"`
+	// production networks can't use development features (like mnemonic accounts)
+	Production bool `json:"production"`
+	// keep validators order in extra data as is (only for already launched networks, otherwise they are sorted)
+	LegacyValidatorOrder bool `json:"legacyValidatorOrder"`
 }
 
-func invokeConstructorOrPanic(genesis *core.Genesis, contract common.Address, rawArtifact []byte, typeNames []string, params []interface{}, silent bool, balance *big.Int) {
+func invokeConstructorOrPanic(genesis *core.Genesis, contract common.Address, rawArtifact []byte, typeNames []string, params []interface{}, silent bool, balance *big.Int, opts buildOptions) *deploymentStats {
 	ctor, err := newArguments(typeNames...).Pack(params...)
 	if err != nil {
 		panic(err)
@@ -231,25 +328,57 @@ func invokeConstructorOrPanic(genesis *core.Genesis, contract common.Address, ra
 	if !silent {
 		fmt.Printf(" + calling constructor: address=%s sig=%s ctor=%s\n", contract.Hex(), hexutil.Encode(sig), hexutil.Encode(ctor))
 	}
-	if err := simulateSystemContract(genesis, contract, rawArtifact, ctor, balance); err != nil {
+	stats, err := simulateSystemContract(genesis, contract, rawArtifact, ctor, balance, opts)
+	if err != nil {
 		panic(err)
 	}
+	if !silent {
+		fmt.Printf(" + deployed %s: %s\n", stats.ContractName, stats)
+	}
+	return stats
+}
+
+// checkAllocConflict makes sure that address is not allocated yet, otherwise allocations silently override each other
+func checkAllocConflict(genesis *core.Genesis, address common.Address, source string) error {
+	if _, ok := genesis.Alloc[address]; ok {
+		return fmt.Errorf("%s address %s conflicts with existing genesis allocation", source, address.Hex())
+	}
+	return nil
+}
+
+func parseInitialStake(config genesisConfig, validator common.Address) (*big.Int, error) {
+	rawInitialStake, ok := config.InitialStakes[validator]
+	if !ok {
+		return nil, fmt.Errorf("initial stake is not found for validator: %s", validator.Hex())
+	}
+	return hexutil.DecodeBig(rawInitialStake)
 }
 
-func createGenesisConfig(config genesisConfig, targetFile string) error {
+func createGenesisConfig(config genesisConfig, targetFile string, opts buildOptions) error {
+	if err := resolveKeystoreReferences(&config); err != nil {
+		return err
+	}
+	if err := applyMnemonicAccounts(&config); err != nil {
+		return err
+	}
+	if opts.RequireKeys {
+		if err := checkValidatorKeys(config, opts.KeystorePaths); err != nil {
+			return err
+		}
+	}
 	genesis := defaultGenesisConfig(config)
 	// extra data
-	genesis.ExtraData = createExtraData(config.Validators)
+	extraData, err := createExtraData(genesis, config)
+	if err != nil {
+		return err
+	}
+	genesis.ExtraData = extraData
 	genesis.Config.Parlia.Epoch = uint64(config.ConsensusParams.EpochBlockInterval)
 	// execute system contracts
 	var initialStakes []*big.Int
 	initialStakeTotal := big.NewInt(0)
 	for _, v := range config.Validators {
-		rawInitialStake, ok := config.InitialStakes[v]
-		if !ok {
-			return fmt.Errorf("initial stake is not found for validator: %s", v.Hex())
-		}
-		initialStake, err := hexutil.DecodeBig(rawInitialStake)
+		initialStake, err := parseInitialStake(config, v)
 		if err != nil {
 			return err
 		}
@@ -257,12 +386,20 @@ func createGenesisConfig(config genesisConfig, targetFile string) error {
 		initialStakeTotal.Add(initialStakeTotal, initialStake)
 	}
 	silent := targetFile == "stdout"
-	invokeConstructorOrPanic(genesis, stakingAddress, stakingRawArtifact, []string{"address[]", "uint256[]", "uint16"}, []interface{}{
+	artifacts, err := loadSystemArtifacts(opts)
+	if err != nil {
+		return err
+	}
+	if !silent && (opts.TestMode || len(opts.ArtifactOverrides) > 0) {
+		fmt.Printf(" ! system contracts are replaced (test mode=%t, overrides=%s), don't use this genesis in production\n", opts.TestMode, opts.ArtifactOverrides)
+	}
+	var deployments []*deploymentStats
+	deployments = append(deployments, invokeConstructorOrPanic(genesis, stakingAddress, artifacts.Staking, []string{"address[]", "uint256[]", "uint16"}, []interface{}{
 		config.Validators,
 		initialStakes,
 		uint16(config.CommissionRate),
-	}, silent, initialStakeTotal)
-	invokeConstructorOrPanic(genesis, chainConfigAddress, chainConfigRawArtifact, []string{"uint32", "uint32", "uint32", "uint32", "uint32", "uint32", "uint256", "uint256"}, []interface{}{
+	}, silent, initialStakeTotal, opts))
+	deployments = append(deployments, invokeConstructorOrPanic(genesis, chainConfigAddress, artifacts.ChainConfig, []string{"uint32", "uint32", "uint32", "uint32", "uint32", "uint32", "uint256", "uint256"}, []interface{}{
 		config.ConsensusParams.ActiveValidatorsLength,
 		config.ConsensusParams.EpochBlockInterval,
 		config.ConsensusParams.MisdemeanorThreshold,
@@ -271,27 +408,34 @@ func createGenesisConfig(config genesisConfig, targetFile string) error {
 		config.ConsensusParams.UndelegatePeriod,
 		(*big.Int)(config.ConsensusParams.MinValidatorStakeAmount),
 		(*big.Int)(config.ConsensusParams.MinStakingAmount),
-	}, silent, nil)
-	invokeConstructorOrPanic(genesis, slashingIndicatorAddress, slashingIndicatorRawArtifact, []string{}, []interface{}{}, silent, nil)
-	invokeConstructorOrPanic(genesis, stakingPoolAddress, stakingPoolRawArtifact, []string{}, []interface{}{}, silent, nil)
+	}, silent, nil, opts))
+	deployments = append(deployments, invokeConstructorOrPanic(genesis, slashingIndicatorAddress, artifacts.SlashingIndicator, []string{}, []interface{}{}, silent, nil, opts))
+	deployments = append(deployments, invokeConstructorOrPanic(genesis, stakingPoolAddress, artifacts.StakingPool, []string{}, []interface{}{}, silent, nil, opts))
 	var treasuryAddresses []common.Address
 	var treasuryShares []uint16
 	for k, v := range config.SystemTreasury {
 		treasuryAddresses = append(treasuryAddresses, k)
 		treasuryShares = append(treasuryShares, v)
 	}
-	invokeConstructorOrPanic(genesis, systemRewardAddress, systemRewardRawArtifact, []string{"address[]", "uint16[]"}, []interface{}{
+	deployments = append(deployments, invokeConstructorOrPanic(genesis, systemRewardAddress, artifacts.SystemReward, []string{"address[]", "uint16[]"}, []interface{}{
 		treasuryAddresses, treasuryShares,
-	}, silent, nil)
-	invokeConstructorOrPanic(genesis, governanceAddress, governanceRawArtifact, []string{"uint256"}, []interface{}{
+	}, silent, nil, opts))
+	deployments = append(deployments, invokeConstructorOrPanic(genesis, governanceAddress, artifacts.Governance, []string{"uint256"}, []interface{}{
 		big.NewInt(config.VotingPeriod),
-	}, silent, nil)
-	invokeConstructorOrPanic(genesis, runtimeUpgradeAddress, runtimeUpgradeRawArtifact, []string{"address"}, []interface{}{
+	}, silent, nil, opts))
+	deployments = append(deployments, invokeConstructorOrPanic(genesis, runtimeUpgradeAddress, artifacts.RuntimeUpgrade, []string{"address"}, []interface{}{
 		systemcontracts.EvmHookRuntimeUpgradeAddress,
-	}, silent, nil)
-	invokeConstructorOrPanic(genesis, deployerProxyAddress, deployerProxyRawArtifact, []string{"address[]"}, []interface{}{
+	}, silent, nil, opts))
+	deployments = append(deployments, invokeConstructorOrPanic(genesis, deployerProxyAddress, artifacts.DeployerProxy, []string{"address[]"}, []interface{}{
 		config.Deployers,
-	}, silent, nil)
+	}, silent, nil, opts))
+	if len(artifacts.RuntimeUpgradeEvmHook) > 0 {
+		stats, err := deployRuntimeUpgradeEvmHook(genesis, artifacts.RuntimeUpgradeEvmHook, silent, opts)
+		if err != nil {
+			return err
+		}
+		deployments = append(deployments, stats)
+	}
 	// create system contract
 	genesis.Alloc[intermediarySystemAddress] = core.GenesisAccount{
 		Balance: big.NewInt(0),
@@ -300,16 +444,66 @@ func createGenesisConfig(config genesisConfig, targetFile string) error {
 	stakingAlloc := genesis.Alloc[stakingAddress]
 	stakingAlloc.Balance = initialStakeTotal
 	genesis.Alloc[stakingAddress] = stakingAlloc
+	// deploy canonical utility contracts
+	if err := deployUtilityPredeploys(genesis, config.Utilities, silent, opts); err != nil {
+		return err
+	}
+	// deploy rtf token collection
+	if config.RTFToken != nil {
+		stats, err := deployRTFToken(genesis, config.RTFToken, silent, opts)
+		if err != nil {
+			return err
+		}
+		deployments = append(deployments, stats)
+	}
+	// deploy user contracts
+	predeployRegistrations, err := deployPredeploys(genesis, config.Predeploys, silent, opts)
+	if err != nil {
+		return err
+	}
+	// apply raw accounts
+	if err := applyRawAlloc(genesis, config.RawAlloc, silent); err != nil {
+		return err
+	}
 	// apply faucet
 	for key, value := range config.Faucet {
 		balance, ok := new(big.Int).SetString(value[2:], 16)
 		if !ok {
 			return fmt.Errorf("failed to parse number (%s)", value)
 		}
+		if err := checkAllocConflict(genesis, key, "faucet"); err != nil {
+			return err
+		}
 		genesis.Alloc[key] = core.GenesisAccount{
 			Balance: balance,
 		}
 	}
+	// initialize system contracts in memory to verify the state and run bootstrap calls on top of it
+	statedb, evm, err := newInitializedGenesisState(genesis, opts.GasLimit)
+	if err != nil {
+		return err
+	}
+	if err := verifyGenesisInvariants(evm, config, silent); err != nil {
+		return err
+	}
+	// registration of predeployed contracts and bootstrap calls modify initialized state, it's committed into genesis
+	if len(predeployRegistrations) > 0 || len(config.Bootstrap) > 0 {
+		if err := registerPredeploys(evm, predeployRegistrations, opts.GasLimit, silent); err != nil {
+			return err
+		}
+		if err := applyBootstrapCalls(genesis, statedb, evm, config.Bootstrap, silent); err != nil {
+			return err
+		}
+		commitStateToAlloc(genesis, statedb)
+	}
+	if err := verifyGenesisExpectations(evm, config, silent); err != nil {
+		return err
+	}
+	if opts.ExportEvents {
+		if err := writeGenesisEvents(targetFile, deployments); err != nil {
+			return err
+		}
+	}
 	// save to file
 	newJson, _ := json.MarshalIndent(genesis, "", "  ")
 	if targetFile == "stdout" {
@@ -354,6 +548,7 @@ func defaultGenesisConfig(config genesisConfig) *core.Genesis {
 		MoranBlock:   big.NewInt(0),
 		GibbsBlock:   big.NewInt(0),
 		PlanckBlock:  big.NewInt(0),
+		LubanBlock:   decimalToBigInt(config.Forks.LubanBlock),
 		BerlinBlock:  big.NewInt(0),
 		LondonBlock:  big.NewInt(0),
 		HertzBlock:   big.NewInt(0),
@@ -432,6 +627,7 @@ var devNetConfig = genesisConfig{
 		common.HexToAddress("0x49c0f7c8c11a4c80dc6449efe1010bb166818da8"),
 		common.HexToAddress("0x8e1ea6eaa09c3b40f4a51fcd056a031870a0549a"),
 	},
+	LegacyValidatorOrder: true,
 	SystemTreasury: map[common.Address]uint16{
 		common.HexToAddress("0x0000000000000000000000000000000000000000"): 10000,
 	},
@@ -478,6 +674,7 @@ var testNetConfig = genesisConfig{
 		common.HexToAddress("0xC72FD6515FeE82e737b34eb8BA9DB4C4A35D47Ac"),
 		common.HexToAddress("0x17EBd907EFFD60C83a3450689e1936AfeFaC38Da"),
 	},
+	LegacyValidatorOrder: true,
 	SystemTreasury: map[common.Address]uint16{
 		common.HexToAddress("0x9C9459Aaf90df6347D4585726F0e97802788f830"): 10000,
 	},
@@ -527,6 +724,7 @@ var spicyConfig = genesisConfig{
 		common.HexToAddress("0xbdBF08393b66130B4b243863150A265b2A5Df642"),
 		common.HexToAddress("0x86f2BB174c450917A1b560c66525E64A1c9B6a04"),
 	},
+	LegacyValidatorOrder: true,
 	SystemTreasury: map[common.Address]uint16{
 		common.HexToAddress("0x060eA461Cf7E78A38400dE9255687beb9b2c7298"): 10000,
 	},
@@ -576,6 +774,7 @@ var mainNetConfig = genesisConfig{
 		common.HexToAddress("0x053b4d178AdFA5b8C06d55A7765D6d1486d5c6a0"),
 		common.HexToAddress("0xaF3aD38D80E5D4668ddF8CA170Cb941ff5f02244"),
 	},
+	LegacyValidatorOrder: true,
 	/**
 	 * Here is  share distribution values. (Second parameter in SystemTreasury map)
 	 *
@@ -624,7 +823,82 @@ var mainNetConfig = genesisConfig{
 }
 
 func main() {
-	args := os.Args[1:]
+	opts := buildOptions{ArtifactOverrides: artifactOverrides{}}
+	flag.StringVar(&opts.TraceDir, "trace", "", "directory to write call and prestate traces of system contracts create and init")
+	flag.Uint64Var(&opts.GasLimit, "gas-limit", defaultSystemContractGasLimit, "gas limit for system contracts create and init calls")
+	flag.BoolVar(&opts.ExportEvents, "events", false, "export events emitted during genesis construction into <genesis>.events.json")
+	flag.BoolVar(&opts.TestMode, "test-mode", false, "replace SystemReward, RuntimeUpgrade, DeployerProxy and EVM hook with fakes from contracts/tests")
+	flag.Var(opts.ArtifactOverrides, "artifact", "system contract artifact override in the format Contract=path/to/artifact.json (can be repeated)")
+	flag.Var(&opts.KeystorePaths, "keystore", "keystore file or directory with validator keys for --require-keys (can be repeated)")
+	flag.BoolVar(&opts.RequireKeys, "require-keys", false, "check that every validator has a key in keystore")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) > 0 && args[0] == "devnet" {
+		if len(args) < 2 || args[1] != "new" {
+			panic("usage: devnet new --validators N [--chain-id ID] [--out DIR] [--image IMAGE] [--password-file FILE]")
+		}
+		if err := createDevnet(args[2:], opts); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "smoke" {
+		if err := runSmokeTest(args[1:]); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "simulate" {
+		if err := runSimulation(args[1:]); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "storage-layout" {
+		if err := checkStorageLayouts(args[1:]); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "rehearse-upgrade" {
+		if err := rehearseUpgrade(args[1:], opts); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "upgrade" {
+		if err := runRuntimeUpgrade(args[1:], opts); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "governance-tx" {
+		if err := createGovernanceTx(args[1:]); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "plan" {
+		if err := planGovernance(args[1:]); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "vote" {
+		if err := runVoteCommand(args[1:]); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "inspect" {
+		if len(args) < 2 {
+			panic("usage: inspect <genesis.json|header.json|0x...>")
+		}
+		if err := inspectExtraData(args[1]); err != nil {
+			panic(err)
+		}
+		return
+	}
 	if len(args) > 0 {
 		fileContents, err := os.ReadFile(args[0])
 		if err != nil {
@@ -639,30 +913,30 @@ func main() {
 		if len(args) > 1 {
 			outputFile = args[1]
 		}
-		err = createGenesisConfig(*genesis, outputFile)
+		err = createGenesisConfig(*genesis, outputFile, opts)
 		if err != nil {
 			panic(err)
 		}
 		return
 	}
 	fmt.Printf("building localnet\n")
-	if err := createGenesisConfig(localNetConfig, "localnet.json"); err != nil {
+	if err := createGenesisConfig(localNetConfig, "localnet.json", opts); err != nil {
 		panic(err)
 	}
 	fmt.Printf("\nbuilding devnet\n")
-	if err := createGenesisConfig(devNetConfig, "devnet.json"); err != nil {
+	if err := createGenesisConfig(devNetConfig, "devnet.json", opts); err != nil {
 		panic(err)
 	}
 	fmt.Printf("\nbuilding scoville testnet\n")
-	if err := createGenesisConfig(testNetConfig, "testnet.json"); err != nil {
+	if err := createGenesisConfig(testNetConfig, "testnet.json", opts); err != nil {
 		panic(err)
 	}
 	fmt.Printf("\nbuilding spicy testnet\n")
-	if err := createGenesisConfig(spicyConfig, "spicy.json"); err != nil {
+	if err := createGenesisConfig(spicyConfig, "spicy.json", opts); err != nil {
 		panic(err)
 	}
 	fmt.Printf("\nbuilding mainnet\n")
-	if err := createGenesisConfig(mainNetConfig, "mainnet.json"); err != nil {
+	if err := createGenesisConfig(mainNetConfig, "mainnet.json", opts); err != nil {
 		panic(err)
 	}
 	fmt.Printf("\n")
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const (
+	devnetP2PPort  = 30303
+	devnetHTTPPort = 8545
+	// nodes get static addresses in the docker network, so static peers don't depend on DNS resolution
+	devnetSubnet       = "172.28.0.0/16"
+	devnetFirstIP      = 10
+	devnetInitialStake = "0x3635c9adc5dea00000"  // 1000 ether
+	devnetBalance      = "0x21e19e0c9bab2400000" // 10000 ether
+)
+
+type devnetNode struct {
+	Name      string
+	IP        string
+	Validator common.Address
+	Enode     string
+	HTTPPort  int
+}
+
+// nodeConfigTemplate is geth TOML config, everything that isn't set here uses client defaults
+var nodeConfigTemplate = template.Must(template.New("config.toml").Parse(`[Eth]
+NetworkId = {{.ChainId}}
+SyncMode = "full"
+
+[Node]
+DataDir = "/data"
+HTTPHost = "0.0.0.0"
+HTTPPort = {{.HTTPPort}}
+HTTPVirtualHosts = ["*"]
+HTTPModules = ["eth", "net", "web3", "txpool", "parlia"]
+
+[Node.P2P]
+MaxPeers = 50
+NoDiscovery = true
+ListenAddr = ":{{.P2PPort}}"
+StaticNodes = [{{range $i, $peer := .StaticNodes}}{{if $i}}, {{end}}"{{$peer}}"{{end}}]
+`))
+
+var dockerComposeTemplate = template.Must(template.New("docker-compose.yml").Parse(`version: "3.8"
+
+services:
+{{- range .Nodes}}
+  {{.Name}}:
+    image: {{$.Image}}
+    entrypoint: ["/bin/sh", "-c"]
+    command:
+      - >-
+        geth init --datadir /data /genesis.json &&
+        geth --config /data/config.toml --mine --miner.etherbase {{.Validator.Hex}}
+        --unlock {{.Validator.Hex}} --password /password.txt --allow-insecure-unlock
+    volumes:
+      - ./genesis.json:/genesis.json:ro
+      - ./password.txt:/password.txt:ro
+      - ./{{.Name}}:/data
+    ports:
+      - "{{.HTTPPort}}:{{$.HTTPPort}}"
+    networks:
+      devnet:
+        ipv4_address: {{.IP}}
+{{- end}}
+
+networks:
+  devnet:
+    ipam:
+      config:
+        - subnet: {{.Subnet}}
+`))
+
+func randomPassword() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func writeTemplate(path string, tmpl *template.Template, data interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return tmpl.Execute(file, data)
+}
+
+// newDevnetConfig returns localnet-like config where every generated validator is staked, funded and can deploy
+func newDevnetConfig(chainId int64, validators []common.Address) genesisConfig {
+	config := genesisConfig{
+		ChainId:         chainId,
+		Deployers:       validators,
+		Validators:      validators,
+		SystemTreasury:  map[common.Address]uint16{validators[0]: 10000},
+		ConsensusParams: localNetConfig.ConsensusParams,
+		VotingPeriod:    localNetConfig.VotingPeriod,
+		InitialStakes:   make(map[common.Address]string),
+		Faucet:          make(map[common.Address]string),
+	}
+	for _, validator := range validators {
+		config.InitialStakes[validator] = devnetInitialStake
+		config.Faucet[validator] = devnetBalance
+	}
+	return config
+}
+
+// prepareDevnetDir creates the output directory, existing directory is used only if it's empty, so files of another
+// devnet are never reused. The returned cleanup removes everything written into the directory on failure
+func prepareDevnetDir(dir string) (func(), error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+		return func() {
+			os.RemoveAll(dir)
+		}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("output directory %s is not empty", dir)
+	}
+	return func() {
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			os.RemoveAll(filepath.Join(dir, entry.Name()))
+		}
+	}, nil
+}
+
+// createDevnet generates keystores, password file, genesis, per-node configs and docker-compose file in the
+// output directory, every node has its own data directory with validator key and node key
+func createDevnet(args []string, opts buildOptions) (err error) {
+	flags := flag.NewFlagSet("devnet new", flag.ExitOnError)
+	validatorsCount := flags.Int("validators", 3, "number of validators")
+	chainId := flags.Int64("chain-id", 1337, "chain id of the network")
+	outputDir := flags.String("out", "./devnet", "output directory")
+	image := flags.String("image", "rtf-geth:latest", "docker image of the node")
+	passwordFile := flags.String("password-file", "", "password for keystores (random password is generated if empty)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *validatorsCount < 1 || *validatorsCount > 200 {
+		return fmt.Errorf("number of validators must be between 1 and 200")
+	}
+	cleanup, err := prepareDevnetDir(*outputDir)
+	if err != nil {
+		return err
+	}
+	// half-written devnet can't be used, so it's removed and the command can be rerun
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+	password, err := randomPassword()
+	if err != nil {
+		return err
+	}
+	if *passwordFile != "" {
+		rawPassword, err := os.ReadFile(*passwordFile)
+		if err != nil {
+			return err
+		}
+		password = strings.TrimRight(string(rawPassword), "\r\n")
+	}
+	if err := ioutil.WriteFile(filepath.Join(*outputDir, "password.txt"), []byte(password+"\n"), 0600); err != nil {
+		return err
+	}
+	_, subnet, err := net.ParseCIDR(devnetSubnet)
+	if err != nil {
+		return err
+	}
+	// generate validator keys and node keys
+	var nodes []*devnetNode
+	var validators []common.Address
+	for i := 0; i < *validatorsCount; i++ {
+		node := &devnetNode{Name: fmt.Sprintf("node%d", i), HTTPPort: devnetHTTPPort + i}
+		nodeDir := filepath.Join(*outputDir, node.Name)
+		// light scrypt params are enough for dev keys, otherwise node startup takes too long
+		ks := keystore.NewKeyStore(filepath.Join(nodeDir, "keystore"), keystore.LightScryptN, keystore.LightScryptP)
+		account, err := ks.NewAccount(password)
+		if err != nil {
+			return err
+		}
+		node.Validator = account.Address
+		nodeKey, err := crypto.GenerateKey()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(nodeDir, "geth"), os.ModePerm); err != nil {
+			return err
+		}
+		if err := crypto.SaveECDSA(filepath.Join(nodeDir, "geth", "nodekey"), nodeKey); err != nil {
+			return err
+		}
+		ip := make(net.IP, len(subnet.IP.To4()))
+		copy(ip, subnet.IP.To4())
+		ip[3] = byte(devnetFirstIP + i)
+		node.IP = ip.String()
+		node.Enode = enode.NewV4(&nodeKey.PublicKey, ip, devnetP2PPort, devnetP2PPort).URLv4()
+		nodes = append(nodes, node)
+		validators = append(validators, node.Validator)
+	}
+	// every node uses all other nodes as static peers
+	for _, node := range nodes {
+		var staticNodes []string
+		for _, peer := range nodes {
+			if peer != node {
+				staticNodes = append(staticNodes, peer.Enode)
+			}
+		}
+		err := writeTemplate(filepath.Join(*outputDir, node.Name, "config.toml"), nodeConfigTemplate, map[string]interface{}{
+			"ChainId":     *chainId,
+			"HTTPPort":    devnetHTTPPort,
+			"P2PPort":     devnetP2PPort,
+			"StaticNodes": staticNodes,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// keep config next to the genesis, so genesis can be rebuilt with the same validators
+	config := newDevnetConfig(*chainId, validators)
+	rawConfig, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(*outputDir, "config.json"), rawConfig, fs.ModePerm); err != nil {
+		return err
+	}
+	if err := createGenesisConfig(config, filepath.Join(*outputDir, "genesis.json"), opts); err != nil {
+		return err
+	}
+	err = writeTemplate(filepath.Join(*outputDir, "docker-compose.yml"), dockerComposeTemplate, map[string]interface{}{
+		"Nodes":    nodes,
+		"Image":    *image,
+		"HTTPPort": devnetHTTPPort,
+		"Subnet":   devnetSubnet,
+	})
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		fmt.Printf(" + %s: validator=%s ip=%s rpc=http://localhost:%d\n", node.Name, node.Validator.Hex(), node.IP, node.HTTPPort)
+	}
+	fmt.Printf("devnet is written to %s, start it with: docker compose -f %s up\n", *outputDir, filepath.Join(*outputDir, "docker-compose.yml"))
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrepareDevnetDir(t *testing.T) {
+	// missing directory is created and removed completely on cleanup
+	dir := filepath.Join(t.TempDir(), "devnet")
+	cleanup, err := prepareDevnetDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "password.txt"), []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("directory %s isn't removed: %v", dir, err)
+	}
+	// existing empty directory is kept, only written files are removed
+	dir = t.TempDir()
+	cleanup, err = prepareDevnetDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "node0", "geth"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+	if entries, err := os.ReadDir(dir); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 0 {
+		t.Fatalf("directory %s isn't emptied", dir)
+	}
+	// non-empty directory is refused
+	if err := os.WriteFile(filepath.Join(dir, "genesis.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prepareDevnetDir(dir); err == nil {
+		t.Fatal("non-empty directory is accepted")
+	}
+}
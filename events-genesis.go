@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// genesisEvent is a log emitted during genesis construction, these logs don't exist on chain, so
+// indexers can use exported events to seed their databases (validators, deployers, shares etc)
+type genesisEvent struct {
+	LogIndex  int                    `json:"logIndex"`
+	Address   common.Address         `json:"address"`
+	Contract  string                 `json:"contract"`
+	Stage     string                 `json:"stage"`
+	Event     string                 `json:"event,omitempty"`
+	Signature string                 `json:"signature,omitempty"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+	Topics    []common.Hash          `json:"topics"`
+	Data      hexutil.Bytes          `json:"data"`
+}
+
+// toJsonValue makes unpacked values JSON friendly (big numbers as decimal strings and bytes as hex)
+func toJsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *big.Int:
+		return v.String()
+	case []byte:
+		return hexutil.Bytes(v)
+	case common.Address, common.Hash, string, bool:
+		return v
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			bytes := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(bytes), rv)
+			return hexutil.Bytes(bytes)
+		}
+		fallthrough
+	case reflect.Slice:
+		var result []interface{}
+		for i := 0; i < rv.Len(); i++ {
+			result = append(result, toJsonValue(rv.Index(i).Interface()))
+		}
+		return result
+	}
+	return value
+}
+
+// unpackEvent finds event by the first topic and unpacks its arguments, nil args are returned if event is known,
+// but its data can't be unpacked
+func unpackEvent(contractAbi abi.ABI, log *types.Log) (*abi.Event, map[string]interface{}) {
+	if len(log.Topics) == 0 {
+		return nil, nil
+	}
+	abiEvent, err := contractAbi.EventByID(log.Topics[0])
+	if err != nil {
+		return nil, nil
+	}
+	args := make(map[string]interface{})
+	var indexed abi.Arguments
+	for _, input := range abiEvent.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if err := abiEvent.Inputs.UnpackIntoMap(args, log.Data); err != nil {
+		return abiEvent, nil
+	}
+	if err := abi.ParseTopicsIntoMap(args, indexed, log.Topics[1:]); err != nil {
+		return abiEvent, nil
+	}
+	return abiEvent, args
+}
+
+// decodeGenesisEvents decodes logs using contract ABI, unknown logs are kept in the raw format
+func decodeGenesisEvents(contractAbi abi.ABI, contractName, stage string, logs []*types.Log) []genesisEvent {
+	var result []genesisEvent
+	for _, log := range logs {
+		event := genesisEvent{
+			Address:  log.Address,
+			Contract: contractName,
+			Stage:    stage,
+			Topics:   log.Topics,
+			Data:     log.Data,
+		}
+		if abiEvent, args := unpackEvent(contractAbi, log); abiEvent != nil {
+			event.Event, event.Signature = abiEvent.Name, abiEvent.Sig
+			if args != nil {
+				event.Args = make(map[string]interface{})
+				for key, value := range args {
+					event.Args[key] = toJsonValue(value)
+				}
+			}
+		}
+		result = append(result, event)
+	}
+	return result
+}
+
+// eventsFileName returns file name for the genesis events, it's placed next to the genesis file
+func eventsFileName(targetFile string) string {
+	return strings.TrimSuffix(targetFile, ".json") + ".events.json"
+}
+
+func writeGenesisEvents(targetFile string, deployments []*deploymentStats) error {
+	if targetFile == "stdout" || targetFile == "stderr" {
+		return fmt.Errorf("events export requires genesis output file")
+	}
+	events := make([]genesisEvent, 0)
+	for _, deployment := range deployments {
+		for _, event := range deployment.Events {
+			event.LogIndex = len(events)
+			events = append(events, event)
+		}
+	}
+	newJson, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(eventsFileName(targetFile), newJson, fs.ModePerm)
+}
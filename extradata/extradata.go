@@ -0,0 +1,213 @@
+// Package extradata implements encoding of the Parlia header extra data field, it has the following layout:
+// vanity (32 bytes) | validators (20 bytes each, only for genesis and epoch blocks) | seal (65 bytes)
+//
+// Since Luban fork every validator is followed by BLS vote address and validators are prefixed with their count:
+// vanity (32 bytes) | count (1 byte) | (validator (20 bytes) | vote address (48 bytes))* | vote attestation | seal (65 bytes)
+package extradata
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// VanityLength is a fixed number of extra data prefix bytes reserved for the signer vanity
+	VanityLength = 32
+	// SealLength is a fixed number of extra data suffix bytes reserved for the signer seal
+	SealLength = 65
+	// VoteAddressLength is a length of the BLS public key used for fast finality votes
+	VoteAddressLength = 48
+	// maximum number of validators that can be encoded in the Luban layout (count is a single byte)
+	maxLubanValidators = 255
+)
+
+// VoteAddress is a BLS public key of the validator
+type VoteAddress [VoteAddressLength]byte
+
+var (
+	ErrMissingVanity           = errors.New("extra data is missing 32 bytes vanity prefix")
+	ErrMissingSeal             = errors.New("extra data is missing 65 bytes seal suffix")
+	ErrVanityTooLong           = errors.New("vanity can't be longer than 32 bytes")
+	ErrInvalidValidatorsLength = errors.New("validators section length is not a multiple of address length")
+	ErrDuplicateValidator      = errors.New("duplicate validator")
+	ErrUnsortedValidators      = errors.New("validators are not sorted in ascending order")
+	ErrTooManyValidators       = errors.New("too many validators for the Luban layout")
+	ErrVoteAddressesMismatch   = errors.New("number of vote addresses doesn't match number of validators")
+)
+
+// ExtraData is a decoded extra data field of the genesis or epoch block header
+type ExtraData struct {
+	Vanity     [VanityLength]byte
+	Validators []common.Address
+	// vote addresses of the validators (in the same order), set only for Luban layout
+	VoteAddresses []VoteAddress
+	// RLP encoded vote attestation, set only for Luban layout
+	VoteAttestation []byte
+	Seal            [SealLength]byte
+}
+
+// SortValidators sorts validators in ascending order, the same way as Parlia does for the epoch blocks
+func SortValidators(validators []common.Address) {
+	sort.Slice(validators, func(i, j int) bool {
+		return bytes.Compare(validators[i][:], validators[j][:]) < 0
+	})
+}
+
+func checkDuplicates(validators []common.Address) error {
+	seen := make(map[common.Address]bool, len(validators))
+	for _, validator := range validators {
+		if seen[validator] {
+			return fmt.Errorf("%w: %s", ErrDuplicateValidator, validator.Hex())
+		}
+		seen[validator] = true
+	}
+	return nil
+}
+
+// EncodeInOrder encodes extra data keeping validators order as is, it's needed only for the networks that are
+// already launched with unsorted validators (genesis hash must not change)
+func EncodeInOrder(vanity []byte, validators []common.Address) ([]byte, error) {
+	if len(vanity) > VanityLength {
+		return nil, ErrVanityTooLong
+	}
+	if err := checkDuplicates(validators); err != nil {
+		return nil, err
+	}
+	extra := make([]byte, VanityLength+common.AddressLength*len(validators)+SealLength)
+	copy(extra, vanity)
+	for i, v := range validators {
+		copy(extra[VanityLength+common.AddressLength*i:], v.Bytes())
+	}
+	return extra, nil
+}
+
+// Encode encodes extra data with validators sorted in ascending order, vanity is right padded with zeros
+func Encode(vanity []byte, validators []common.Address) ([]byte, error) {
+	sorted := make([]common.Address, len(validators))
+	copy(sorted, validators)
+	SortValidators(sorted)
+	return EncodeInOrder(vanity, sorted)
+}
+
+// Decode decodes extra data of any block header, only genesis and epoch blocks have validators
+func Decode(extra []byte) (*ExtraData, error) {
+	if len(extra) < VanityLength {
+		return nil, ErrMissingVanity
+	}
+	if len(extra) < VanityLength+SealLength {
+		return nil, ErrMissingSeal
+	}
+	validatorsBytes := extra[VanityLength : len(extra)-SealLength]
+	if len(validatorsBytes)%common.AddressLength != 0 {
+		return nil, ErrInvalidValidatorsLength
+	}
+	result := &ExtraData{}
+	copy(result.Vanity[:], extra[:VanityLength])
+	copy(result.Seal[:], extra[len(extra)-SealLength:])
+	for i := 0; i < len(validatorsBytes); i += common.AddressLength {
+		result.Validators = append(result.Validators, common.BytesToAddress(validatorsBytes[i:i+common.AddressLength]))
+	}
+	return result, nil
+}
+
+func validateValidators(validators []common.Address) error {
+	if err := checkDuplicates(validators); err != nil {
+		return err
+	}
+	for i := 1; i < len(validators); i++ {
+		if bytes.Compare(validators[i-1][:], validators[i][:]) > 0 {
+			return fmt.Errorf("%w: %s goes before %s", ErrUnsortedValidators, validators[i-1].Hex(), validators[i].Hex())
+		}
+	}
+	return nil
+}
+
+// Validate checks extra data layout, validators must be unique and sorted in ascending order
+func Validate(extra []byte) error {
+	decoded, err := Decode(extra)
+	if err != nil {
+		return err
+	}
+	return validateValidators(decoded.Validators)
+}
+
+// EncodeLuban encodes extra data in the Luban layout, validators are sorted in ascending order together with
+// their vote addresses
+func EncodeLuban(vanity []byte, validators []common.Address, voteAddresses []VoteAddress) ([]byte, error) {
+	if len(vanity) > VanityLength {
+		return nil, ErrVanityTooLong
+	}
+	if len(validators) != len(voteAddresses) {
+		return nil, ErrVoteAddressesMismatch
+	}
+	if len(validators) > maxLubanValidators {
+		return nil, ErrTooManyValidators
+	}
+	if err := checkDuplicates(validators); err != nil {
+		return nil, err
+	}
+	indices := make([]int, len(validators))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		return bytes.Compare(validators[indices[i]][:], validators[indices[j]][:]) < 0
+	})
+	const entryLength = common.AddressLength + VoteAddressLength
+	extra := make([]byte, VanityLength+1+entryLength*len(validators)+SealLength)
+	copy(extra, vanity)
+	extra[VanityLength] = byte(len(validators))
+	for i, index := range indices {
+		offset := VanityLength + 1 + entryLength*i
+		copy(extra[offset:], validators[index].Bytes())
+		copy(extra[offset+common.AddressLength:], voteAddresses[index][:])
+	}
+	return extra, nil
+}
+
+// DecodeLuban decodes extra data of the genesis or epoch block in the Luban layout, other headers don't have
+// validators (and count byte) at all, so they can't be decoded with this function
+func DecodeLuban(extra []byte) (*ExtraData, error) {
+	if len(extra) < VanityLength {
+		return nil, ErrMissingVanity
+	}
+	if len(extra) < VanityLength+SealLength {
+		return nil, ErrMissingSeal
+	}
+	result := &ExtraData{}
+	copy(result.Vanity[:], extra[:VanityLength])
+	copy(result.Seal[:], extra[len(extra)-SealLength:])
+	payload := extra[VanityLength : len(extra)-SealLength]
+	if len(payload) == 0 {
+		return result, nil
+	}
+	const entryLength = common.AddressLength + VoteAddressLength
+	count := int(payload[0])
+	if len(payload) < 1+count*entryLength {
+		return nil, ErrInvalidValidatorsLength
+	}
+	for i := 0; i < count; i++ {
+		offset := 1 + entryLength*i
+		result.Validators = append(result.Validators, common.BytesToAddress(payload[offset:offset+common.AddressLength]))
+		var voteAddress VoteAddress
+		copy(voteAddress[:], payload[offset+common.AddressLength:offset+entryLength])
+		result.VoteAddresses = append(result.VoteAddresses, voteAddress)
+	}
+	if attestation := payload[1+count*entryLength:]; len(attestation) > 0 {
+		result.VoteAttestation = attestation
+	}
+	return result, nil
+}
+
+// ValidateLuban checks extra data in the Luban layout, validators must be unique and sorted in ascending order
+func ValidateLuban(extra []byte) error {
+	decoded, err := DecodeLuban(extra)
+	if err != nil {
+		return err
+	}
+	return validateValidators(decoded.Validators)
+}
@@ -0,0 +1,154 @@
+package extradata
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	validatorA = common.HexToAddress("0x08fae3885e299c24ff9841478eb946f41023ac69")
+	validatorB = common.HexToAddress("0x751aaca849b09a3e347bbfe125cf18423cc24b40")
+	validatorC = common.HexToAddress("0xa6ff33e3250cc765052ac9d7f7dfebda183c4b9b")
+)
+
+func voteAddress(b byte) VoteAddress {
+	var result VoteAddress
+	for i := range result {
+		result[i] = b
+	}
+	return result
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	extra, err := Encode([]byte("vanity"), []common.Address{validatorC, validatorA, validatorB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extra) != VanityLength+3*common.AddressLength+SealLength {
+		t.Fatalf("bad extra data length: %d", len(extra))
+	}
+	if err := Validate(extra); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(decoded.Vanity[:], []byte("vanity")) {
+		t.Fatalf("bad vanity: %x", decoded.Vanity)
+	}
+	expected := []common.Address{validatorA, validatorB, validatorC}
+	if len(decoded.Validators) != len(expected) {
+		t.Fatalf("bad validators: %v", decoded.Validators)
+	}
+	for i := range expected {
+		if decoded.Validators[i] != expected[i] {
+			t.Fatalf("validator #%d: expected %s, got %s", i, expected[i].Hex(), decoded.Validators[i].Hex())
+		}
+	}
+}
+
+func TestEncodeInOrderKeepsOrder(t *testing.T) {
+	extra, err := EncodeInOrder(nil, []common.Address{validatorC, validatorA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Validators[0] != validatorC || decoded.Validators[1] != validatorA {
+		t.Fatalf("order is changed: %v", decoded.Validators)
+	}
+	if err := Validate(extra); !errors.Is(err, ErrUnsortedValidators) {
+		t.Fatalf("expected unsorted validators error, got %v", err)
+	}
+}
+
+func TestDuplicateValidators(t *testing.T) {
+	if _, err := Encode(nil, []common.Address{validatorA, validatorB, validatorA}); !errors.Is(err, ErrDuplicateValidator) {
+		t.Fatalf("expected duplicate validator error, got %v", err)
+	}
+	if _, err := EncodeLuban(nil, []common.Address{validatorA, validatorA}, []VoteAddress{voteAddress(1), voteAddress(2)}); !errors.Is(err, ErrDuplicateValidator) {
+		t.Fatalf("expected duplicate validator error, got %v", err)
+	}
+	extra, err := EncodeInOrder(nil, []common.Address{validatorA, validatorB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(extra[VanityLength+common.AddressLength:], validatorA.Bytes())
+	if err := Validate(extra); !errors.Is(err, ErrDuplicateValidator) {
+		t.Fatalf("expected duplicate validator error, got %v", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, err := Decode(make([]byte, VanityLength-1)); !errors.Is(err, ErrMissingVanity) {
+		t.Fatalf("expected missing vanity error, got %v", err)
+	}
+	if _, err := Decode(make([]byte, VanityLength+SealLength-1)); !errors.Is(err, ErrMissingSeal) {
+		t.Fatalf("expected missing seal error, got %v", err)
+	}
+	if _, err := Decode(make([]byte, VanityLength+SealLength+1)); !errors.Is(err, ErrInvalidValidatorsLength) {
+		t.Fatalf("expected invalid validators length error, got %v", err)
+	}
+	if _, err := Encode(make([]byte, VanityLength+1), nil); !errors.Is(err, ErrVanityTooLong) {
+		t.Fatalf("expected vanity too long error, got %v", err)
+	}
+}
+
+func TestLubanRoundTrip(t *testing.T) {
+	extra, err := EncodeLuban([]byte("vanity"), []common.Address{validatorC, validatorA}, []VoteAddress{voteAddress(0xc), voteAddress(0xa)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extra) != VanityLength+1+2*(common.AddressLength+VoteAddressLength)+SealLength {
+		t.Fatalf("bad extra data length: %d", len(extra))
+	}
+	if extra[VanityLength] != 2 {
+		t.Fatalf("bad validators count: %d", extra[VanityLength])
+	}
+	if err := ValidateLuban(extra); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeLuban(extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// vote addresses are sorted together with their validators
+	if decoded.Validators[0] != validatorA || decoded.VoteAddresses[0] != voteAddress(0xa) {
+		t.Fatalf("bad first entry: %s %x", decoded.Validators[0].Hex(), decoded.VoteAddresses[0])
+	}
+	if decoded.Validators[1] != validatorC || decoded.VoteAddresses[1] != voteAddress(0xc) {
+		t.Fatalf("bad second entry: %s %x", decoded.Validators[1].Hex(), decoded.VoteAddresses[1])
+	}
+	if decoded.VoteAttestation != nil {
+		t.Fatalf("unexpected vote attestation: %x", decoded.VoteAttestation)
+	}
+}
+
+func TestLubanErrors(t *testing.T) {
+	if _, err := EncodeLuban(nil, []common.Address{validatorA}, nil); !errors.Is(err, ErrVoteAddressesMismatch) {
+		t.Fatalf("expected vote addresses mismatch error, got %v", err)
+	}
+	validators := make([]common.Address, maxLubanValidators+1)
+	voteAddresses := make([]VoteAddress, maxLubanValidators+1)
+	for i := range validators {
+		validators[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+	}
+	if _, err := EncodeLuban(nil, validators, voteAddresses); !errors.Is(err, ErrTooManyValidators) {
+		t.Fatalf("expected too many validators error, got %v", err)
+	}
+	extra, err := EncodeLuban(nil, []common.Address{validatorA}, []VoteAddress{voteAddress(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra[VanityLength] = 2
+	if _, err := DecodeLuban(extra); !errors.Is(err, ErrInvalidValidatorsLength) {
+		t.Fatalf("expected invalid validators length error, got %v", err)
+	}
+}
@@ -11,7 +11,11 @@ replace (
 	github.com/tendermint/tendermint => github.com/bnb-chain/tendermint v0.31.15
 )
 
-require github.com/ethereum/go-ethereum v1.11.3
+require (
+	github.com/ethereum/go-ethereum v1.11.3
+	github.com/prysmaticlabs/prysm/v4 v4.0.8
+	github.com/tyler-smith/go-bip39 v1.1.0
+)
 
 require (
 	github.com/DataDog/zstd v1.5.2 // indirect
@@ -91,7 +95,6 @@ require (
 	github.com/prysmaticlabs/fastssz v0.0.0-20221107182844-78142813af44 // indirect
 	github.com/prysmaticlabs/gohashtree v0.0.3-alpha // indirect
 	github.com/prysmaticlabs/prysm v0.0.0-20220124113610-e26cde5e091b // indirect
-	github.com/prysmaticlabs/prysm/v4 v4.0.8 // indirect
 	github.com/rcrowley/go-metrics v0.0.0-20201227073835-cf1acfcdf475 // indirect
 	github.com/rivo/uniseg v0.4.4 // indirect
 	github.com/rogpeppe/go-internal v1.9.0 // indirect
@@ -109,7 +112,6 @@ require (
 	github.com/thomaso-mirodin/intmath v0.0.0-20160323211736-5dc6d854e46e // indirect
 	github.com/tklauser/go-sysconf v0.3.12 // indirect
 	github.com/tklauser/numcpus v0.6.1 // indirect
-	github.com/tyler-smith/go-bip39 v1.1.0 // indirect
 	github.com/urfave/cli/v2 v2.25.7 // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
 	github.com/yusufpapurcu/wmi v1.2.2 // indirect
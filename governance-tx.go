@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var systemContractAddresses = map[string]common.Address{
+	"Staking":           stakingAddress,
+	"SlashingIndicator": slashingIndicatorAddress,
+	"SystemReward":      systemRewardAddress,
+	"StakingPool":       stakingPoolAddress,
+	"Governance":        governanceAddress,
+	"ChainConfig":       chainConfigAddress,
+	"RuntimeUpgrade":    runtimeUpgradeAddress,
+	"DeployerProxy":     deployerProxyAddress,
+}
+
+// proposalAction is a single call of the proposal. System contracts can be referenced by name and their methods
+// by name only (argument types are taken from ABI), other contracts need full method signature. Calldata is used
+// as is if method isn't specified
+type proposalAction struct {
+	Contract string                `json:"contract,omitempty"`
+	Target   *common.Address       `json:"target,omitempty"`
+	Value    *math.HexOrDecimal256 `json:"value,omitempty"`
+	Method   string                `json:"method,omitempty"`
+	Args     []json.RawMessage     `json:"args,omitempty"`
+	Calldata hexutil.Bytes         `json:"calldata,omitempty"`
+}
+
+// resolve returns target address and calldata of the action, methods of system contracts are checked against
+// their ABI, so typos in signatures are caught before proposal is created
+func (a proposalAction) resolve(abis map[common.Address]abi.ABI) (common.Address, []byte, error) {
+	var target common.Address
+	if a.Contract != "" {
+		address, ok := systemContractAddresses[a.Contract]
+		if !ok {
+			return common.Address{}, nil, fmt.Errorf("unknown system contract: %s", a.Contract)
+		}
+		target = address
+	} else if a.Target != nil {
+		target = *a.Target
+	} else {
+		return common.Address{}, nil, fmt.Errorf("either contract or target must be specified")
+	}
+	if a.Method == "" {
+		return target, a.Calldata, nil
+	}
+	contractAbi, isSystemContract := abis[target]
+	if strings.Contains(a.Method, "(") {
+		method, input, err := packMethodCall(a.Method, a.Args)
+		if err != nil {
+			return common.Address{}, nil, err
+		}
+		if isSystemContract {
+			if _, err := contractAbi.MethodById(method.ID); err != nil {
+				return common.Address{}, nil, fmt.Errorf("system contract %s doesn't have method %s", target.Hex(), a.Method)
+			}
+		}
+		return target, input, nil
+	}
+	if !isSystemContract {
+		return common.Address{}, nil, fmt.Errorf("method signature is required for %s (%s)", target.Hex(), a.Method)
+	}
+	method, ok := contractAbi.Methods[a.Method]
+	if !ok {
+		return common.Address{}, nil, fmt.Errorf("system contract %s doesn't have method %s", target.Hex(), a.Method)
+	}
+	args, err := decodeArguments(method.Inputs, a.Args)
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("%s: %w", method.Sig, err)
+	}
+	input, err := method.Inputs.Pack(args...)
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("%s: %w", method.Sig, err)
+	}
+	return target, append(method.ID, input...), nil
+}
+
+type governanceTxRequest struct {
+	Description string           `json:"description"`
+	Actions     []proposalAction `json:"actions"`
+}
+
+// governanceTx is everything needed to propose and execute the proposal, signed transaction is added only
+// if signing is requested
+type governanceTx struct {
+	Targets         []common.Address        `json:"targets"`
+	Values          []*math.HexOrDecimal256 `json:"values"`
+	Calldatas       []hexutil.Bytes         `json:"calldatas"`
+	Description     string                  `json:"description"`
+	DescriptionHash common.Hash             `json:"descriptionHash"`
+	ProposalId      *math.HexOrDecimal256   `json:"proposalId"`
+	ProposeCalldata hexutil.Bytes           `json:"proposeCalldata"`
+	ExecuteCalldata hexutil.Bytes           `json:"executeCalldata"`
+	ExecuteValue    *math.HexOrDecimal256   `json:"executeValue"`
+	SignedTx        hexutil.Bytes           `json:"signedTx,omitempty"`
+	SignedTxHash    *common.Hash            `json:"signedTxHash,omitempty"`
+}
+
+func packSignatureCall(signature string, args ...interface{}) ([]byte, error) {
+	method, err := parseMethodSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	input, err := method.Inputs.Pack(args...)
+	if err != nil {
+		return nil, err
+	}
+	return append(method.ID, input...), nil
+}
+
+// buildGovernanceTx encodes propose and execute calls, proposal id is calculated the same way as
+// Governor.hashProposal does
+func buildGovernanceTx(request governanceTxRequest) (*governanceTx, error) {
+	if len(request.Actions) == 0 {
+		return nil, fmt.Errorf("proposal doesn't have actions")
+	}
+	abis, err := systemContractAbis()
+	if err != nil {
+		return nil, err
+	}
+	result := &governanceTx{Description: request.Description, DescriptionHash: crypto.Keccak256Hash([]byte(request.Description))}
+	var values []*big.Int
+	var calldatas [][]byte
+	totalValue := big.NewInt(0)
+	for i, action := range request.Actions {
+		target, input, err := action.resolve(abis)
+		if err != nil {
+			return nil, fmt.Errorf("action #%d: %w", i, err)
+		}
+		value := bigOrZero(action.Value)
+		result.Targets = append(result.Targets, target)
+		result.Values = append(result.Values, (*math.HexOrDecimal256)(value))
+		result.Calldatas = append(result.Calldatas, input)
+		values, calldatas = append(values, value), append(calldatas, input)
+		totalValue.Add(totalValue, value)
+	}
+	result.ExecuteValue = (*math.HexOrDecimal256)(totalValue)
+	hashInput, err := packSignatureCall("hashProposal(address[],uint256[],bytes[],bytes32)", result.Targets, values, calldatas, [32]byte(result.DescriptionHash))
+	if err != nil {
+		return nil, err
+	}
+	result.ProposalId = (*math.HexOrDecimal256)(new(big.Int).SetBytes(crypto.Keccak256(hashInput[4:])))
+	if result.ProposeCalldata, err = packSignatureCall("propose(address[],uint256[],bytes[],string)", result.Targets, values, calldatas, request.Description); err != nil {
+		return nil, err
+	}
+	if result.ExecuteCalldata, err = packSignatureCall("execute(address[],uint256[],bytes[],bytes32)", result.Targets, values, calldatas, [32]byte(result.DescriptionHash)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// signOffline signs transaction with the keystore key, nothing is requested from the node, so nonce, gas
+// price and chain id must be provided
+func signOffline(keystoreDir, passwordFile string, from common.Address, tx *types.Transaction, chainId *big.Int) (*types.Transaction, error) {
+	password, err := readPasswordFile(passwordFile)
+	if err != nil {
+		return nil, err
+	}
+	ks := keystore.NewKeyStore(keystoreDir, keystore.StandardScryptN, keystore.StandardScryptP)
+	if !ks.HasAddress(from) {
+		return nil, fmt.Errorf("keystore doesn't have key of %s", from.Hex())
+	}
+	return ks.SignTxWithPassphrase(accounts.Account{Address: from}, password, tx, chainId)
+}
+
+// createGovernanceTx builds propose and execute calldata from the human-readable action list and optionally
+// signs one of these transactions offline
+func createGovernanceTx(args []string) error {
+	flags := flag.NewFlagSet("governance-tx", flag.ExitOnError)
+	sign := flags.String("sign", "", "sign transaction offline (propose or execute)")
+	keystoreDir := flags.String("keystore", "./keystore", "keystore directory with the signer key")
+	passwordFile := flags.String("password", "./password.txt", "password file for the keystore")
+	from := flags.String("from", "", "signer address (proposer)")
+	nonce := flags.Int64("nonce", -1, "signer nonce")
+	chainId := flags.Uint64("chain-id", 0, "chain id")
+	gasLimit := flags.Uint64("gas", 0, "gas limit (required for signing, execute of large proposals needs much more than propose)")
+	gasPrice := flags.Uint64("gas-price", 0, "gas price in wei (required for signing)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 {
+		return fmt.Errorf("usage: governance-tx [--sign propose|execute --from ADDRESS --nonce N --chain-id ID --gas N --gas-price WEI] <actions.json> [output.json]")
+	}
+	fileContents, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var request governanceTxRequest
+	if err := json.Unmarshal(fileContents, &request); err != nil {
+		return err
+	}
+	result, err := buildGovernanceTx(request)
+	if err != nil {
+		return err
+	}
+	if *sign != "" {
+		if !common.IsHexAddress(*from) || *nonce < 0 || *chainId == 0 || *gasLimit == 0 || *gasPrice == 0 {
+			return fmt.Errorf("signing requires --from, --nonce, --chain-id, --gas and --gas-price")
+		}
+		var tx *types.Transaction
+		switch *sign {
+		case "propose":
+			tx = types.NewTransaction(uint64(*nonce), governanceAddress, big.NewInt(0), *gasLimit, new(big.Int).SetUint64(*gasPrice), result.ProposeCalldata)
+		case "execute":
+			tx = types.NewTransaction(uint64(*nonce), governanceAddress, (*big.Int)(result.ExecuteValue), *gasLimit, new(big.Int).SetUint64(*gasPrice), result.ExecuteCalldata)
+		default:
+			return fmt.Errorf("unknown transaction to sign: %s", *sign)
+		}
+		signed, err := signOffline(*keystoreDir, *passwordFile, common.HexToAddress(*from), tx, new(big.Int).SetUint64(*chainId))
+		if err != nil {
+			return err
+		}
+		if result.SignedTx, err = signed.MarshalBinary(); err != nil {
+			return err
+		}
+		txHash := signed.Hash()
+		result.SignedTxHash = &txHash
+	}
+	newJson, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if flags.NArg() < 2 {
+		fmt.Printf("%s\n", newJson)
+		return nil
+	}
+	return ioutil.WriteFile(flags.Arg(1), newJson, fs.ModePerm)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+)
+
+func TestProposalActionResolve(t *testing.T) {
+	abis, err := systemContractAbis()
+	if err != nil {
+		t.Fatal(err)
+	}
+	setEpochBlockInterval, err := packSignatureCall("setEpochBlockInterval(uint32)", uint32(600))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	transfer, err := packSignatureCall("transfer(address,uint256)", token, big.NewInt(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name     string
+		action   proposalAction
+		target   common.Address
+		calldata []byte
+		err      string
+	}{
+		{
+			name:     "method name of system contract",
+			action:   proposalAction{Contract: "ChainConfig", Method: "setEpochBlockInterval", Args: jsonArgs("600")},
+			target:   chainConfigAddress,
+			calldata: setEpochBlockInterval,
+		},
+		{
+			name:     "signature of system contract",
+			action:   proposalAction{Target: &chainConfigAddress, Method: "setEpochBlockInterval(uint32)", Args: jsonArgs("600")},
+			target:   chainConfigAddress,
+			calldata: setEpochBlockInterval,
+		},
+		{
+			name:   "signature not in system contract ABI",
+			action: proposalAction{Contract: "ChainConfig", Method: "setEpochBlockInterval(uint64)", Args: jsonArgs("600")},
+			err:    "doesn't have method",
+		},
+		{
+			name:   "unknown method name",
+			action: proposalAction{Contract: "ChainConfig", Method: "setEpochInterval", Args: jsonArgs("600")},
+			err:    "doesn't have method",
+		},
+		{
+			name:   "bad argument",
+			action: proposalAction{Contract: "ChainConfig", Method: "setEpochBlockInterval", Args: jsonArgs("0x100000000")},
+			err:    "out of uint32 range",
+		},
+		{
+			name:   "method name of other contract",
+			action: proposalAction{Target: &token, Method: "transfer", Args: jsonArgs(token, "1000")},
+			err:    "method signature is required",
+		},
+		{
+			name:     "signature of other contract",
+			action:   proposalAction{Target: &token, Method: "transfer(address,uint256)", Args: jsonArgs(token, "1000")},
+			target:   token,
+			calldata: transfer,
+		},
+		{
+			name:     "raw calldata",
+			action:   proposalAction{Target: &token, Calldata: hexutil.MustDecode("0xdeadbeef")},
+			target:   token,
+			calldata: hexutil.MustDecode("0xdeadbeef"),
+		},
+		{
+			name:   "unknown system contract",
+			action: proposalAction{Contract: "Treasury", Method: "withdraw"},
+			err:    "unknown system contract",
+		},
+		{
+			name:   "no target",
+			action: proposalAction{Calldata: hexutil.MustDecode("0xdeadbeef")},
+			err:    "either contract or target",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			target, calldata, err := test.action.resolve(abis)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected %q error, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if target != test.target {
+				t.Fatalf("expected target %s, got %s", test.target.Hex(), target.Hex())
+			}
+			if !bytes.Equal(calldata, test.calldata) {
+				t.Fatalf("expected calldata %x, got %x", test.calldata, calldata)
+			}
+		})
+	}
+}
+
+func TestBuildGovernanceTxProposalId(t *testing.T) {
+	ctx := context.Background()
+	upgrader, _, owner := newTestUpgrader(t)
+	tx, err := buildGovernanceTx(governanceTxRequest{
+		Description: "Reconcile network parameters with config",
+		Actions: []proposalAction{
+			{Contract: "ChainConfig", Method: "setEpochBlockInterval", Args: jsonArgs("600")},
+			{Contract: "SystemReward", Method: "updateDistributionShare", Args: jsonArgs([]common.Address{owner}, []uint16{10000})},
+			{Target: &owner, Value: (*math.HexOrDecimal256)(big.NewInt(1000))},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []*big.Int
+	var calldatas [][]byte
+	for i := range tx.Targets {
+		values, calldatas = append(values, (*big.Int)(tx.Values[i])), append(calldatas, tx.Calldatas[i])
+	}
+	result, err := upgrader.call(ctx, common.Address{}, governanceAddress, "hashProposal(address[],uint256[],bytes[],bytes32)(uint256)", tx.Targets, values, calldatas, [32]byte(tx.DescriptionHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proposalId := result[0].(*big.Int); proposalId.Cmp((*big.Int)(tx.ProposalId)) != 0 {
+		t.Fatalf("proposal id mismatch: %s != %s", (*big.Int)(tx.ProposalId), proposalId)
+	}
+	if (*big.Int)(tx.ExecuteValue).Cmp(big.NewInt(1000)) != 0 {
+		t.Fatalf("bad execute value: %s", (*big.Int)(tx.ExecuteValue))
+	}
+	// propose with the encoded calldata returns the same id
+	output, err := upgrader.backend.CallContract(ctx, ethereum.CallMsg{From: owner, To: &governanceAddress, Data: tx.ProposeCalldata}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proposalId := new(big.Int).SetBytes(output); proposalId.Cmp((*big.Int)(tx.ProposalId)) != 0 {
+		t.Fatalf("propose returns another proposal id: %s != %s", proposalId, (*big.Int)(tx.ProposalId))
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"create-genesis/extradata"
+)
+
+// readExtraData reads extra data from the genesis or block header JSON file, raw hex string is accepted as well.
+// Luban layout is used if Luban fork is active at genesis, for headers and raw extra data it's detected by length
+func readExtraData(source string) ([]byte, bool, error) {
+	if strings.HasPrefix(source, "0x") {
+		extra, err := hexutil.Decode(source)
+		return extra, !isLegacyLayout(extra), err
+	}
+	fileContents, err := os.ReadFile(source)
+	if err != nil {
+		return nil, false, err
+	}
+	var header struct {
+		ExtraData hexutil.Bytes `json:"extraData"`
+		Config    *struct {
+			LubanBlock *big.Int `json:"lubanBlock"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(fileContents, &header); err != nil {
+		return nil, false, err
+	}
+	if len(header.ExtraData) == 0 {
+		return nil, false, fmt.Errorf("extra data is not found in %s", source)
+	}
+	if header.Config != nil {
+		luban := header.Config.LubanBlock != nil && header.Config.LubanBlock.Sign() == 0
+		return header.ExtraData, luban, nil
+	}
+	return header.ExtraData, !isLegacyLayout(header.ExtraData), nil
+}
+
+func isLegacyLayout(extra []byte) bool {
+	_, err := extradata.Decode(extra)
+	return err == nil
+}
+
+func inspectExtraData(source string) error {
+	extra, luban, err := readExtraData(source)
+	if err != nil {
+		return err
+	}
+	decode, validate := extradata.Decode, extradata.Validate
+	if luban {
+		decode, validate = extradata.DecodeLuban, extradata.ValidateLuban
+	}
+	decoded, err := decode(extra)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("vanity: %s\n", hexutil.Encode(decoded.Vanity[:]))
+	fmt.Printf("validators (%d):\n", len(decoded.Validators))
+	for i, validator := range decoded.Validators {
+		if luban {
+			fmt.Printf(" %d. %s vote address: %s\n", i+1, validator.Hex(), hexutil.Encode(decoded.VoteAddresses[i][:]))
+		} else {
+			fmt.Printf(" %d. %s\n", i+1, validator.Hex())
+		}
+	}
+	fmt.Printf("seal: %s\n", hexutil.Encode(decoded.Seal[:]))
+	// unsorted validators are reported, but it's not an error for already launched networks
+	if err := validate(extra); err != nil {
+		fmt.Printf("warning: %s\n", err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// keystoreReferences lets config use keystore files or directories instead of addresses, addresses are read from
+// keystore JSON files without decryption
+type keystoreReferences struct {
+	Validators    []string          `json:"validators"`
+	Deployers     []string          `json:"deployers"`
+	InitialStakes map[string]string `json:"initialStakes"`
+	Faucet        map[string]string `json:"faucet"`
+}
+
+// pathList is a flag that can be repeated
+type pathList []string
+
+func (l *pathList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *pathList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func readKeystoreAddress(path string) (common.Address, error) {
+	fileContents, err := os.ReadFile(path)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var key struct {
+		Address string `json:"address"`
+	}
+	if err := json.Unmarshal(fileContents, &key); err != nil {
+		return common.Address{}, fmt.Errorf("failed to parse keystore (%s): %w", path, err)
+	}
+	if !common.IsHexAddress(key.Address) {
+		return common.Address{}, fmt.Errorf("keystore (%s) doesn't have valid address", path)
+	}
+	return common.HexToAddress(key.Address), nil
+}
+
+// readKeystoreAddresses reads addresses from keystore file or all keystore files in the directory (ordered by file
+// name, so UTC-- files are ordered by creation time), hidden files and editor backups are skipped like geth does
+func readKeystoreAddresses(path string) ([]common.Address, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		address, err := readKeystoreAddress(path)
+		if err != nil {
+			return nil, err
+		}
+		return []common.Address{address}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	var result []common.Address
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+			continue
+		}
+		address, err := readKeystoreAddress(filepath.Join(path, name))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, address)
+	}
+	return result, nil
+}
+
+func resolveAddressList(target []common.Address, paths []string) ([]common.Address, error) {
+	for _, path := range paths {
+		addresses, err := readKeystoreAddresses(path)
+		if err != nil {
+			return nil, err
+		}
+		target = append(target, addresses...)
+	}
+	return target, nil
+}
+
+func resolveAddressMap(target map[common.Address]string, references map[string]string, section string) (map[common.Address]string, error) {
+	if len(references) > 0 && target == nil {
+		target = make(map[common.Address]string)
+	}
+	// iterate in the stable order to make conflict errors reproducible
+	var paths []string
+	for path := range references {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		addresses, err := readKeystoreAddresses(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			if _, ok := target[address]; ok {
+				return nil, fmt.Errorf("%s for %s is set more than once (keystore %s)", section, address.Hex(), path)
+			}
+			target[address] = references[path]
+		}
+	}
+	return target, nil
+}
+
+// resolveKeystoreReferences adds addresses from the keystore references to the config
+func resolveKeystoreReferences(config *genesisConfig) error {
+	var err error
+	refs := config.Keystores
+	if config.Validators, err = resolveAddressList(config.Validators, refs.Validators); err != nil {
+		return err
+	}
+	if config.Deployers, err = resolveAddressList(config.Deployers, refs.Deployers); err != nil {
+		return err
+	}
+	if config.InitialStakes, err = resolveAddressMap(config.InitialStakes, refs.InitialStakes, "initial stake"); err != nil {
+		return err
+	}
+	if config.Faucet, err = resolveAddressMap(config.Faucet, refs.Faucet, "faucet"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkValidatorKeys makes sure every validator has a key in one of the referenced keystores or keystore paths
+// passed with --keystore flag
+func checkValidatorKeys(config genesisConfig, keystorePaths []string) error {
+	available := make(map[common.Address]bool)
+	paths := append([]string{}, keystorePaths...)
+	paths = append(paths, config.Keystores.Validators...)
+	for _, path := range paths {
+		addresses, err := readKeystoreAddresses(path)
+		if err != nil {
+			return err
+		}
+		for _, address := range addresses {
+			available[address] = true
+		}
+	}
+	var missing []string
+	for _, validator := range config.Validators {
+		if !available[validator] {
+			missing = append(missing, validator.Hex())
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("keys are not found for validators: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// chain ids of the production networks, mnemonic accounts are never allowed there
+var productionChainIds = map[int64]bool{
+	32199: true, // mainnet
+}
+
+// mnemonicAccounts derives development accounts from BIP-39 mnemonic, account with index i uses <path>/i
+// derivation path, first validators and deployers are taken from the derived accounts
+type mnemonicAccounts struct {
+	Phrase       string                `json:"phrase"`
+	Count        int                   `json:"count"`
+	Path         string                `json:"path"`
+	Balance      *math.HexOrDecimal256 `json:"balance"`
+	Validators   int                   `json:"validators"`
+	InitialStake *math.HexOrDecimal256 `json:"initialStake"`
+	Deployers    int                   `json:"deployers"`
+}
+
+type extendedKey struct {
+	key       []byte
+	chainCode []byte
+}
+
+const hardenedKeyStart = 0x80000000
+
+// child derives BIP-32 private child key, hardened keys use private key and normal keys use compressed public key
+func (k *extendedKey) child(index uint32) (*extendedKey, error) {
+	var data []byte
+	if index >= hardenedKeyStart {
+		data = append([]byte{0x00}, k.key...)
+	} else {
+		privateKey, err := crypto.ToECDSA(k.key)
+		if err != nil {
+			return nil, err
+		}
+		data = crypto.CompressPubkey(&privateKey.PublicKey)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+	curveOrder := crypto.S256().Params().N
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(curveOrder) >= 0 {
+		return nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+	childKey := tweak.Add(tweak, new(big.Int).SetBytes(k.key))
+	childKey.Mod(childKey, curveOrder)
+	if childKey.Sign() == 0 {
+		return nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+	return &extendedKey{key: math.PaddedBigBytes(childKey, 32), chainCode: sum[32:]}, nil
+}
+
+// deriveKey derives BIP-32 private key of the path from BIP-39 seed
+func deriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	key := &extendedKey{key: sum[:32], chainCode: sum[32:]}
+	for _, index := range path {
+		var err error
+		if key, err = key.child(index); err != nil {
+			return nil, err
+		}
+	}
+	return crypto.ToECDSA(key.key)
+}
+
+func deriveMnemonicKeys(mnemonic *mnemonicAccounts) ([]*ecdsa.PrivateKey, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic.Phrase, "")
+	if err != nil {
+		return nil, fmt.Errorf("bad mnemonic: %w", err)
+	}
+	path := accounts.DefaultRootDerivationPath
+	if mnemonic.Path != "" {
+		if path, err = accounts.ParseDerivationPath(mnemonic.Path); err != nil {
+			return nil, fmt.Errorf("bad derivation path %s: %w", mnemonic.Path, err)
+		}
+	}
+	var result []*ecdsa.PrivateKey
+	for i := 0; i < mnemonic.Count; i++ {
+		key, err := deriveKey(seed, append(append(accounts.DerivationPath{}, path...), uint32(i)))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, key)
+	}
+	return result, nil
+}
+
+// applyMnemonicAccounts funds derived accounts and makes first of them validators and deployers, private keys are
+// printed to stderr (they're for dev use only and stdout can be used for the genesis)
+func applyMnemonicAccounts(config *genesisConfig) error {
+	accounts := config.Mnemonic
+	if accounts == nil {
+		return nil
+	}
+	if config.Production || productionChainIds[config.ChainId] {
+		return fmt.Errorf("mnemonic accounts are not allowed for production chain id %d", config.ChainId)
+	}
+	if accounts.Count <= 0 || accounts.Validators > accounts.Count || accounts.Deployers > accounts.Count || accounts.Validators < 0 || accounts.Deployers < 0 {
+		return fmt.Errorf("bad mnemonic accounts count (count=%d, validators=%d, deployers=%d)", accounts.Count, accounts.Validators, accounts.Deployers)
+	}
+	keys, err := deriveMnemonicKeys(accounts)
+	if err != nil {
+		return err
+	}
+	balance := hexutil.MustDecodeBig(devnetBalance)
+	if accounts.Balance != nil {
+		balance = (*big.Int)(accounts.Balance)
+	}
+	initialStake := hexutil.MustDecodeBig(devnetInitialStake)
+	if accounts.InitialStake != nil {
+		initialStake = (*big.Int)(accounts.InitialStake)
+	}
+	if config.Faucet == nil {
+		config.Faucet = make(map[common.Address]string)
+	}
+	if config.InitialStakes == nil && accounts.Validators > 0 {
+		config.InitialStakes = make(map[common.Address]string)
+	}
+	fmt.Fprintf(os.Stderr, "WARNING: mnemonic accounts are for development only, never use them in public networks\n")
+	for i, key := range keys {
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		if _, ok := config.Faucet[address]; ok {
+			return fmt.Errorf("mnemonic account %s is already funded by faucet", address.Hex())
+		}
+		config.Faucet[address] = hexutil.EncodeBig(balance)
+		var roles []string
+		if i < accounts.Validators {
+			config.Validators = append(config.Validators, address)
+			config.InitialStakes[address] = hexutil.EncodeBig(initialStake)
+			roles = append(roles, "validator")
+		}
+		if i < accounts.Deployers {
+			config.Deployers = append(config.Deployers, address)
+			roles = append(roles, "deployer")
+		}
+		fmt.Fprintf(os.Stderr, " %d. %s key=%s %s\n", i, address.Hex(), hexutil.Encode(crypto.FromECDSA(key)), strings.Join(roles, ","))
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// accounts of the standard development mnemonic (hardhat, anvil)
+func TestDeriveMnemonicKeys(t *testing.T) {
+	expected := []common.Address{
+		common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"),
+		common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8"),
+		common.HexToAddress("0x3C44CdDdB6a900fa2b585dd299e03d12FA4293BC"),
+	}
+	for _, path := range []string{"", "m/44'/60'/0'/0"} {
+		keys, err := deriveMnemonicKeys(&mnemonicAccounts{Phrase: "test test test test test test test test test test test junk", Count: len(expected), Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, key := range keys {
+			if address := crypto.PubkeyToAddress(key.PublicKey); address != expected[i] {
+				t.Fatalf("account #%d (path %q): expected %s, got %s", i, path, expected[i].Hex(), address.Hex())
+			}
+		}
+	}
+}
+
+func TestDeriveMnemonicKeysErrors(t *testing.T) {
+	if _, err := deriveMnemonicKeys(&mnemonicAccounts{Phrase: "test test test test test test test test test test test test", Count: 1}); err == nil {
+		t.Fatalf("mnemonic with bad checksum is accepted")
+	}
+	if _, err := deriveMnemonicKeys(&mnemonicAccounts{Phrase: "test test test test test test test test test test test junk", Count: 1, Path: "m/44'/x"}); err == nil {
+		t.Fatalf("bad derivation path is accepted")
+	}
+}
+
+// test vector 1 of BIP-32, chain m/0H/1
+func TestDeriveKeyBip32Vector(t *testing.T) {
+	key, err := deriveKey(common.FromHex("0x000102030405060708090a0b0c0d0e0f"), accounts.DerivationPath{hardenedKeyStart, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if privateKey := common.Bytes2Hex(crypto.FromECDSA(key)); privateKey != "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368" {
+		t.Fatalf("bad private key: %s", privateKey)
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// stateCaller executes read-only call against the current network state (state dump or RPC)
+type stateCaller func(contract common.Address, input []byte) ([]byte, error)
+
+func evmStateCaller(evm *vm.EVM) stateCaller {
+	return func(contract common.Address, input []byte) ([]byte, error) {
+		result, _, err := evm.StaticCall(vm.AccountRef(common.Address{}), contract, input, defaultSystemContractGasLimit)
+		if err != nil {
+			return nil, fmt.Errorf("%s", formatCallError(result, err))
+		}
+		return result, nil
+	}
+}
+
+func rpcStateCaller(ctx context.Context, backend *ethclient.Client) stateCaller {
+	return func(contract common.Address, input []byte) ([]byte, error) {
+		return backend.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: input}, nil)
+	}
+}
+
+// reconcileChange is a difference between the desired config and the current state with the action fixing it
+type reconcileChange struct {
+	diff   string
+	action proposalAction
+}
+
+type reconciler struct {
+	call stateCaller
+	abis map[common.Address]abi.ABI
+	// deployers that might be active on chain (DeployerProxy can't enumerate them)
+	knownDeployers []common.Address
+}
+
+func (r *reconciler) view(contract common.Address, method abi.Method, args ...interface{}) ([]interface{}, error) {
+	input, err := method.Inputs.Pack(args...)
+	if err != nil {
+		return nil, err
+	}
+	output, err := r.call(contract, append(method.ID, input...))
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", method.Sig, err)
+	}
+	return method.Outputs.Unpack(output)
+}
+
+func (r *reconciler) viewSignature(contract common.Address, signature string, args ...interface{}) ([]interface{}, error) {
+	method, err := parseMethodSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	return r.view(contract, method, args...)
+}
+
+func jsonArgs(values ...interface{}) []json.RawMessage {
+	var result []json.RawMessage
+	for _, value := range values {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, raw)
+	}
+	return result
+}
+
+// reconcileConsensusParams compares ChainConfig values, zero (or missing) params aren't managed by the config
+func (r *reconciler) reconcileConsensusParams(desired consensusParams) ([]reconcileChange, error) {
+	params := []struct {
+		name  string
+		value *big.Int
+	}{
+		{"ActiveValidatorsLength", big.NewInt(int64(desired.ActiveValidatorsLength))},
+		{"EpochBlockInterval", big.NewInt(int64(desired.EpochBlockInterval))},
+		{"MisdemeanorThreshold", big.NewInt(int64(desired.MisdemeanorThreshold))},
+		{"FelonyThreshold", big.NewInt(int64(desired.FelonyThreshold))},
+		{"ValidatorJailEpochLength", big.NewInt(int64(desired.ValidatorJailEpochLength))},
+		{"UndelegatePeriod", big.NewInt(int64(desired.UndelegatePeriod))},
+		{"MinValidatorStakeAmount", bigOrZero(desired.MinValidatorStakeAmount)},
+		{"MinStakingAmount", bigOrZero(desired.MinStakingAmount)},
+	}
+	var changes []reconcileChange
+	for _, param := range params {
+		if param.value.Sign() == 0 {
+			continue
+		}
+		// getters return uint32 or uint256, both are encoded as a single word
+		result, err := r.viewSignature(chainConfigAddress, fmt.Sprintf("get%s()(uint256)", param.name))
+		if err != nil {
+			return nil, err
+		}
+		if current := result[0].(*big.Int); current.Cmp(param.value) != 0 {
+			changes = append(changes, reconcileChange{
+				diff:   fmt.Sprintf("ChainConfig.%s: %s -> %s", param.name, current, param.value),
+				action: proposalAction{Contract: "ChainConfig", Method: "set" + param.name, Args: jsonArgs(param.value.String())},
+			})
+		}
+	}
+	return changes, nil
+}
+
+// reconcileSystemTreasury replaces all distribution shares at once, because SystemReward requires total share
+// to be 100%
+func (r *reconciler) reconcileSystemTreasury(desired map[common.Address]uint16) ([]reconcileChange, error) {
+	if len(desired) == 0 {
+		return nil, nil
+	}
+	// updateDistributionShare reverts otherwise, so the proposal would fail only at execute
+	var total uint64
+	for _, share := range desired {
+		total += uint64(share)
+	}
+	if total != 10000 {
+		return nil, fmt.Errorf("system treasury shares sum up to %d, but must be 10000", total)
+	}
+	result, err := r.view(systemRewardAddress, r.abis[systemRewardAddress].Methods["getDistributionShares"])
+	if err != nil {
+		return nil, err
+	}
+	rawShares, err := json.Marshal(result[0])
+	if err != nil {
+		return nil, err
+	}
+	var shares []struct {
+		Account common.Address `json:"account"`
+		Share   uint16         `json:"share"`
+	}
+	if err := json.Unmarshal(rawShares, &shares); err != nil {
+		return nil, err
+	}
+	current := make(map[common.Address]uint16)
+	for _, share := range shares {
+		current[share.Account] = share.Share
+	}
+	var accounts []common.Address
+	for account := range desired {
+		accounts = append(accounts, account)
+	}
+	for account := range current {
+		if _, ok := desired[account]; !ok {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return bytes.Compare(accounts[i][:], accounts[j][:]) < 0
+	})
+	var diff []string
+	for _, account := range accounts {
+		prev, prevOk := current[account]
+		next, nextOk := desired[account]
+		switch {
+		case !prevOk:
+			diff = append(diff, fmt.Sprintf("SystemReward share %s: added %d", account.Hex(), next))
+		case !nextOk:
+			diff = append(diff, fmt.Sprintf("SystemReward share %s: removed %d", account.Hex(), prev))
+		case prev != next:
+			diff = append(diff, fmt.Sprintf("SystemReward share %s: %d -> %d", account.Hex(), prev, next))
+		}
+	}
+	if len(diff) == 0 {
+		return nil, nil
+	}
+	var newAccounts []common.Address
+	var newShares []uint16
+	for _, account := range accounts {
+		if share, ok := desired[account]; ok {
+			newAccounts, newShares = append(newAccounts, account), append(newShares, share)
+		}
+	}
+	changes := []reconcileChange{{
+		diff:   diff[0],
+		action: proposalAction{Contract: "SystemReward", Method: "updateDistributionShare", Args: jsonArgs(newAccounts, newShares)},
+	}}
+	for _, line := range diff[1:] {
+		changes = append(changes, reconcileChange{diff: line})
+	}
+	return changes, nil
+}
+
+// reconcileDeployers adds missing deployers and removes active deployers that aren't in the config, nil list
+// isn't managed by the config
+func (r *reconciler) reconcileDeployers(desired []common.Address) ([]reconcileChange, error) {
+	if desired == nil {
+		return nil, nil
+	}
+	candidates := append(append([]common.Address{}, desired...), r.knownDeployers...)
+	sort.Slice(candidates, func(i, j int) bool {
+		return bytes.Compare(candidates[i][:], candidates[j][:]) < 0
+	})
+	var changes []reconcileChange
+	for i, account := range candidates {
+		if i > 0 && candidates[i-1] == account {
+			continue
+		}
+		result, err := r.viewSignature(deployerProxyAddress, "isDeployer(address)(bool)", account)
+		if err != nil {
+			return nil, err
+		}
+		active, wanted := result[0].(bool), containsAddress(desired, account)
+		if wanted && !active {
+			changes = append(changes, reconcileChange{
+				diff:   fmt.Sprintf("DeployerProxy deployer %s: added", account.Hex()),
+				action: proposalAction{Contract: "DeployerProxy", Method: "addDeployer", Args: jsonArgs(account)},
+			})
+		} else if !wanted && active {
+			changes = append(changes, reconcileChange{
+				diff:   fmt.Sprintf("DeployerProxy deployer %s: removed", account.Hex()),
+				action: proposalAction{Contract: "DeployerProxy", Method: "removeDeployer", Args: jsonArgs(account)},
+			})
+		}
+	}
+	return changes, nil
+}
+
+// deployersFromLogs returns accounts from DeployerAdded events, deployers added at genesis don't have events.
+// Logs are requested in pages, because most nodes limit the block range of a single request
+func deployersFromLogs(ctx context.Context, backend *ethclient.Client, deployerProxyAbi abi.ABI, fromBlock, pageSize uint64) ([]common.Address, error) {
+	if pageSize == 0 {
+		return nil, fmt.Errorf("log page size must be positive")
+	}
+	head, err := backend.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []common.Address
+	for start := fromBlock; start <= head; start += pageSize {
+		end := start + pageSize - 1
+		if end > head {
+			end = head
+		}
+		logs, err := backend.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(start),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Addresses: []common.Address{deployerProxyAddress},
+			Topics:    [][]common.Hash{{deployerProxyAbi.Events["DeployerAdded"].ID}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get DeployerAdded logs (blocks %d-%d): %w", start, end, err)
+		}
+		for _, log := range logs {
+			if len(log.Topics) > 1 {
+				result = append(result, common.BytesToAddress(log.Topics[1].Bytes()))
+			}
+		}
+	}
+	return result, nil
+}
+
+// planGovernance compares desired config with the current state and writes a proposal in the governance-tx
+// format, the diff is printed in a human-readable form
+func planGovernance(args []string) error {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	rpcUrl := flags.String("rpc", "", "node RPC endpoint to read the current state from")
+	dumpFile := flags.String("dump", "", "geth state dump to read the current state from (requires --genesis)")
+	genesisFile := flags.String("genesis", "", "genesis file of the network (used for chain config with --dump)")
+	blockNumber := flags.Uint64("block", 0, "block number of the state dump")
+	blockTime := flags.Uint64("time", 0, "timestamp of the state dump block")
+	currentConfig := flags.String("current", "", "config the network was launched with (its deployers can be removed)")
+	description := flags.String("description", "Reconcile network parameters with config", "proposal description")
+	fromBlock := flags.Uint64("from-block", 0, "first block of the DeployerAdded logs search (RPC only)")
+	logPageSize := flags.Uint64("log-page-size", 5000, "number of blocks per logs request (RPC only)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 || (*rpcUrl == "") == (*dumpFile == "") {
+		return fmt.Errorf("usage: plan (--rpc URL | --dump dump.json --genesis genesis.json [--block N]) [--current config.json] <config.json> [proposal.json]")
+	}
+	var desired genesisConfig
+	fileContents, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(fileContents, &desired); err != nil {
+		return err
+	}
+	abis, err := systemContractAbis()
+	if err != nil {
+		return err
+	}
+	r := &reconciler{abis: abis}
+	if *currentConfig != "" {
+		var current genesisConfig
+		fileContents, err := os.ReadFile(*currentConfig)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(fileContents, &current); err != nil {
+			return err
+		}
+		r.knownDeployers = append(r.knownDeployers, current.Deployers...)
+	}
+	if *rpcUrl != "" {
+		ctx := context.Background()
+		backend, err := ethclient.DialContext(ctx, *rpcUrl)
+		if err != nil {
+			return err
+		}
+		r.call = rpcStateCaller(ctx, backend)
+		deployers, err := deployersFromLogs(ctx, backend, abis[deployerProxyAddress], *fromBlock, *logPageSize)
+		if err != nil {
+			return err
+		}
+		r.knownDeployers = append(r.knownDeployers, deployers...)
+	} else {
+		if *genesisFile == "" {
+			return fmt.Errorf("state dump requires --genesis")
+		}
+		// there are no logs in the state dump, so only deployers of the launch config are checked for removal
+		if desired.Deployers != nil {
+			if *currentConfig == "" {
+				return fmt.Errorf("state dump can't list active deployers, --current is required when deployers are managed")
+			}
+			fmt.Fprintf(os.Stderr, "WARNING: deployers added by governance after launch aren't checked with --dump, use --rpc to remove them\n")
+		}
+		evm, err := newStateDumpEVM(*genesisFile, *dumpFile, *blockNumber, *blockTime, defaultSystemContractGasLimit)
+		if err != nil {
+			return err
+		}
+		r.call = evmStateCaller(evm)
+	}
+	var changes []reconcileChange
+	for _, reconcile := range []func() ([]reconcileChange, error){
+		func() ([]reconcileChange, error) { return r.reconcileConsensusParams(desired.ConsensusParams) },
+		func() ([]reconcileChange, error) { return r.reconcileSystemTreasury(desired.SystemTreasury) },
+		func() ([]reconcileChange, error) { return r.reconcileDeployers(desired.Deployers) },
+	} {
+		result, err := reconcile()
+		if err != nil {
+			return err
+		}
+		changes = append(changes, result...)
+	}
+	if len(changes) == 0 {
+		fmt.Fprintf(os.Stderr, "network state matches config, nothing to propose\n")
+		return nil
+	}
+	request := governanceTxRequest{Description: *description}
+	for _, change := range changes {
+		fmt.Fprintf(os.Stderr, " ~ %s\n", change.diff)
+		if change.action.Method != "" {
+			request.Actions = append(request.Actions, change.action)
+		}
+	}
+	// make sure the proposal can be encoded before it's written
+	if _, err := buildGovernanceTx(request); err != nil {
+		return err
+	}
+	newJson, err := json.MarshalIndent(request, "", "  ")
+	if err != nil {
+		return err
+	}
+	if flags.NArg() < 2 {
+		fmt.Printf("%s\n", newJson)
+		return nil
+	}
+	return ioutil.WriteFile(flags.Arg(1), newJson, fs.ModePerm)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// fakeStateCaller answers view calls of the listed methods (by signature), any other call fails, so the test
+// also checks that unmanaged values aren't requested
+func fakeStateCaller(t *testing.T, outputs map[string][]interface{}) stateCaller {
+	t.Helper()
+	methods := make(map[string]abi.Method)
+	for signature := range outputs {
+		method, err := parseMethodSignature(signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		methods[signature] = method
+	}
+	return func(contract common.Address, input []byte) ([]byte, error) {
+		for signature, method := range methods {
+			if bytes.HasPrefix(input, method.ID) {
+				return method.Outputs.Pack(outputs[signature]...)
+			}
+		}
+		return nil, fmt.Errorf("unexpected call to %s: %x", contract.Hex(), input)
+	}
+}
+
+func newTestReconciler(t *testing.T, call stateCaller) *reconciler {
+	t.Helper()
+	abis, err := systemContractAbis()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &reconciler{call: call, abis: abis}
+}
+
+func assertAction(t *testing.T, change reconcileChange, method string, args ...interface{}) {
+	t.Helper()
+	if change.action.Method != method {
+		t.Fatalf("expected %s action, got %q", method, change.action.Method)
+	}
+	expected, err := json.Marshal(jsonArgs(args...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := json.Marshal(change.action.Args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Fatalf("%s args: expected %s, got %s", method, expected, actual)
+	}
+}
+
+func TestReconcileConsensusParams(t *testing.T) {
+	r := newTestReconciler(t, fakeStateCaller(t, map[string][]interface{}{
+		"getActiveValidatorsLength()(uint256)": {big.NewInt(7)},
+		"getEpochBlockInterval()(uint256)":     {big.NewInt(1200)},
+	}))
+	changes, err := r.reconcileConsensusParams(consensusParams{ActiveValidatorsLength: 7, EpochBlockInterval: 600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected single change, got %+v", changes)
+	}
+	if changes[0].diff != "ChainConfig.EpochBlockInterval: 1200 -> 600" {
+		t.Fatalf("bad diff: %s", changes[0].diff)
+	}
+	assertAction(t, changes[0], "setEpochBlockInterval", "600")
+}
+
+func TestReconcileSystemTreasury(t *testing.T) {
+	accountA := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	accountB := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	accountC := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	type distributionShare struct {
+		Account common.Address
+		Share   uint16
+	}
+	r := newTestReconciler(t, nil)
+	getDistributionShares := r.abis[systemRewardAddress].Methods["getDistributionShares"]
+	current, err := getDistributionShares.Outputs.Pack([]distributionShare{{accountA, 6000}, {accountB, 4000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.call = func(contract common.Address, input []byte) ([]byte, error) {
+		if contract != systemRewardAddress || !bytes.Equal(input, getDistributionShares.ID) {
+			return nil, fmt.Errorf("unexpected call to %s: %x", contract.Hex(), input)
+		}
+		return current, nil
+	}
+	changes, err := r.reconcileSystemTreasury(map[common.Address]uint16{accountA: 5000, accountC: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var diff []string
+	for _, change := range changes {
+		diff = append(diff, change.diff)
+	}
+	expected := []string{
+		"SystemReward share " + accountA.Hex() + ": 6000 -> 5000",
+		"SystemReward share " + accountB.Hex() + ": removed 4000",
+		"SystemReward share " + accountC.Hex() + ": added 5000",
+	}
+	if strings.Join(diff, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("bad diff:\n%s", strings.Join(diff, "\n"))
+	}
+	// all shares are replaced by the single action
+	assertAction(t, changes[0], "updateDistributionShare", []common.Address{accountA, accountC}, []uint16{5000, 5000})
+	for _, change := range changes[1:] {
+		if change.action.Method != "" {
+			t.Fatalf("unexpected action: %+v", change.action)
+		}
+	}
+	// the same shares don't need a proposal
+	if changes, err := r.reconcileSystemTreasury(map[common.Address]uint16{accountA: 6000, accountB: 4000}); err != nil || len(changes) != 0 {
+		t.Fatalf("expected no changes, got %+v (%v)", changes, err)
+	}
+	if _, err := r.reconcileSystemTreasury(map[common.Address]uint16{accountA: 5000, accountB: 4000}); err == nil || !strings.Contains(err.Error(), "must be 10000") {
+		t.Fatalf("expected total share error, got %v", err)
+	}
+}
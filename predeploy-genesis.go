@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type predeployCreate2 struct {
+	Deployer common.Address `json:"deployer"`
+	Salt     common.Hash    `json:"salt"`
+}
+
+// predeployConfig describes user contract that must exist at block 0, the contract address is either fixed or
+// derived using CREATE2 rules (deployer, salt and init code hash)
+type predeployConfig struct {
+	Name     string                `json:"name"`
+	Artifact string                `json:"artifact"`
+	Address  *common.Address       `json:"address"`
+	Create2  *predeployCreate2     `json:"create2"`
+	From     *common.Address       `json:"from"`
+	Args     []json.RawMessage     `json:"args"`
+	Balance  *math.HexOrDecimal256 `json:"balance"`
+	Deployer *common.Address       `json:"deployer"`
+}
+
+// predeployRegistration is a record for DeployerProxy, it's registered the same way as node does for new contracts
+type predeployRegistration struct {
+	Deployer common.Address
+	Contract common.Address
+}
+
+// creator returns msg.sender of the constructor, for CREATE2 it's a deployer (factory)
+func (p *predeployConfig) creator() common.Address {
+	if p.From != nil {
+		return *p.From
+	} else if p.Create2 != nil {
+		return p.Create2.Deployer
+	} else if p.Deployer != nil {
+		return *p.Deployer
+	}
+	return common.Address{}
+}
+
+func (p *predeployConfig) address(initCode []byte) (common.Address, error) {
+	if p.Address != nil && p.Create2 != nil {
+		return common.Address{}, fmt.Errorf("predeploy (%s) must have either fixed or CREATE2 address", p.Name)
+	} else if p.Address != nil {
+		return *p.Address, nil
+	} else if p.Create2 != nil {
+		return crypto.CreateAddress2(p.Create2.Deployer, p.Create2.Salt, crypto.Keccak256(initCode)), nil
+	}
+	return common.Address{}, fmt.Errorf("predeploy (%s) address is not specified", p.Name)
+}
+
+func deployPredeploy(genesis *core.Genesis, predeploy predeployConfig, rawArtifact []byte, silent bool, opts buildOptions) (common.Address, error) {
+	artifact := &artifactData{}
+	if err := json.Unmarshal(rawArtifact, artifact); err != nil {
+		return common.Address{}, err
+	}
+	args, err := decodeArguments(artifact.ABI.Constructor.Inputs, predeploy.Args)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("predeploy (%s) constructor: %w", predeploy.Name, err)
+	}
+	constructor, err := artifact.ABI.Pack("", args...)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("predeploy (%s) constructor: %w", predeploy.Name, err)
+	}
+	bytecode, err := hexutil.Decode(artifact.Bytecode)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("predeploy (%s) has bad bytecode (unlinked libraries?): %w", predeploy.Name, err)
+	}
+	address, err := predeploy.address(append(bytecode, constructor...))
+	if err != nil {
+		return common.Address{}, err
+	}
+	if err := checkAllocConflict(genesis, address, fmt.Sprintf("predeploy (%s)", predeploy.Name)); err != nil {
+		return common.Address{}, err
+	}
+	balance := big.NewInt(0)
+	if predeploy.Balance != nil {
+		balance = (*big.Int)(predeploy.Balance)
+	}
+	stats, err := simulateContract(genesis, address, predeploy.creator(), rawArtifact, constructor, balance, nil, opts)
+	if err != nil {
+		return common.Address{}, err
+	}
+	// contracts are created with nonce 1 (EIP-161)
+	account := genesis.Alloc[address]
+	account.Balance, account.Nonce = balance, 1
+	genesis.Alloc[address] = account
+	if !silent {
+		fmt.Printf(" + predeployed %s (%s): address=%s %s\n", predeploy.Name, stats.ContractName, address.Hex(), stats)
+	}
+	return address, nil
+}
+
+func deployPredeploys(genesis *core.Genesis, predeploys []predeployConfig, silent bool, opts buildOptions) ([]predeployRegistration, error) {
+	var registrations []predeployRegistration
+	for _, predeploy := range predeploys {
+		rawArtifact, err := os.ReadFile(predeploy.Artifact)
+		if err != nil {
+			return nil, fmt.Errorf("predeploy (%s): %w", predeploy.Name, err)
+		}
+		address, err := deployPredeploy(genesis, predeploy, rawArtifact, silent, opts)
+		if err != nil {
+			return nil, err
+		}
+		if predeploy.Deployer != nil {
+			registrations = append(registrations, predeployRegistration{Deployer: *predeploy.Deployer, Contract: address})
+		}
+	}
+	return registrations, nil
+}
+
+// registerPredeploys registers predeployed contracts in the DeployerProxy, node does the same call from coinbase
+// for every contract deployed by whitelisted deployer
+func registerPredeploys(evm *vm.EVM, registrations []predeployRegistration, gasLimit uint64, silent bool) error {
+	for _, registration := range registrations {
+		method, err := parseMethodSignature("registerDeployedContract(address,address)")
+		if err != nil {
+			return err
+		}
+		input, err := method.Inputs.Pack(registration.Deployer, registration.Contract)
+		if err != nil {
+			return err
+		}
+		result, _, err := evm.Call(vm.AccountRef(evm.Context.Coinbase), deployerProxyAddress, append(method.ID, input...), gasLimit, big.NewInt(0))
+		if err != nil {
+			return fmt.Errorf("failed to register predeployed contract %s (deployer %s): %s", registration.Contract.Hex(), registration.Deployer.Hex(), formatCallError(result, err))
+		}
+		if !silent {
+			fmt.Printf(" + registered predeployed contract: address=%s deployer=%s\n", registration.Contract.Hex(), registration.Deployer.Hex())
+		}
+	}
+	return nil
+}
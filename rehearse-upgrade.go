@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// stateDumpAccount is an account of the geth dump, storage keys are only known if preimages are recorded
+// (--cache.preimages), storage values are hex encoded without leading zeros
+type stateDumpAccount struct {
+	Balance string            `json:"balance"`
+	Nonce   uint64            `json:"nonce"`
+	Code    hexutil.Bytes     `json:"code"`
+	Storage map[string]string `json:"storage"`
+	Address *common.Address   `json:"address"`
+}
+
+func (a stateDumpAccount) toGenesisAccount() (core.GenesisAccount, error) {
+	balance, ok := math.ParseBig256(a.Balance)
+	if !ok {
+		return core.GenesisAccount{}, fmt.Errorf("bad balance: %s", a.Balance)
+	}
+	storage := make(map[common.Hash]common.Hash)
+	for key, value := range a.Storage {
+		storage[common.HexToHash(key)] = common.HexToHash(value)
+	}
+	return core.GenesisAccount{Code: a.Code, Storage: storage, Balance: balance, Nonce: a.Nonce}, nil
+}
+
+// readStateDump reads geth dump, both formats are supported: single JSON object with the accounts map
+// and iterative dump (account per line)
+func readStateDump(path string) (core.GenesisAlloc, error) {
+	fileContents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	accounts := make(map[string]stateDumpAccount)
+	var dump struct {
+		Accounts map[string]stateDumpAccount `json:"accounts"`
+	}
+	if err := json.Unmarshal(fileContents, &dump); err == nil && dump.Accounts != nil {
+		accounts = dump.Accounts
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(fileContents))
+		scanner.Buffer(nil, 256*1024*1024)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 || !bytes.Contains(line, []byte(`"address"`)) {
+				continue
+			}
+			var account stateDumpAccount
+			if err := json.Unmarshal(line, &account); err != nil {
+				return nil, fmt.Errorf("failed to parse state dump (%s): %w", path, err)
+			}
+			if account.Address == nil {
+				continue
+			}
+			accounts[account.Address.Hex()] = account
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	alloc := make(core.GenesisAlloc)
+	for key, account := range accounts {
+		address := account.Address
+		if common.IsHexAddress(key) {
+			parsed := common.HexToAddress(key)
+			address = &parsed
+		}
+		if address == nil {
+			return nil, fmt.Errorf("state dump account (%s) doesn't have address, preimages are required", key)
+		}
+		genesisAccount, err := account.toGenesisAccount()
+		if err != nil {
+			return nil, fmt.Errorf("state dump account (%s): %w", address.Hex(), err)
+		}
+		alloc[*address] = genesisAccount
+	}
+	if err := checkStateDumpStorage(alloc); err != nil {
+		return nil, fmt.Errorf("state dump (%s): %w", path, err)
+	}
+	return alloc, nil
+}
+
+// checkStateDumpStorage makes sure that storage keys are real slots, dumps made without preimages have hashed
+// keys (or all keys collapsed into zero one), such state can be loaded, but every call returns garbage. Initialized
+// system contract has Initializable flag in slot 0 and staking address injected into slot 2, not initialized one
+// (genesis dump) has at least constructor params in slot 1
+func checkStateDumpStorage(alloc core.GenesisAlloc) error {
+	initializedSlot, stakingSlot := common.BigToHash(big.NewInt(0)), common.BigToHash(big.NewInt(2))
+	for _, contract := range systemContracts {
+		account, ok := alloc[contract]
+		if !ok || len(account.Code) == 0 || len(account.Storage) == 0 {
+			continue
+		}
+		if account.Storage[initializedSlot] != (common.Hash{}) {
+			if account.Storage[stakingSlot] != stakingAddress.Hash() {
+				return fmt.Errorf("system contract %s doesn't have injector state in slot 2, storage keys look collapsed (dump is made without --cache.preimages?)", contract.Hex())
+			}
+			continue
+		}
+		hasLowSlot := false
+		for key := range account.Storage {
+			if key.Big().BitLen() <= 8 {
+				hasLowSlot = true
+				break
+			}
+		}
+		if !hasLowSlot {
+			return fmt.Errorf("system contract %s doesn't have injector state, storage keys look hashed (dump is made without --cache.preimages?)", contract.Hex())
+		}
+	}
+	return nil
+}
+
+// newStateDumpEVM loads state dump into in-memory state, genesis file is only used for the chain config, block
+// number and time should match the dumped block
+func newStateDumpEVM(genesisFile, dumpFile string, blockNumber, blockTime, gasLimit uint64) (*vm.EVM, error) {
+	genesis, err := loadGenesisFile(genesisFile)
+	if err != nil {
+		return nil, err
+	}
+	if genesis.Alloc, err = readStateDump(dumpFile); err != nil {
+		return nil, err
+	}
+	statedb, err := newGenesisState(genesis)
+	if err != nil {
+		return nil, err
+	}
+	header := &types.Header{
+		Number:     new(big.Int).SetUint64(blockNumber),
+		Time:       blockTime,
+		GasLimit:   genesis.GasLimit,
+		Difficulty: big.NewInt(2),
+	}
+	evm := newGenesisEVM(genesis, statedb, header)
+	if err := initSystemContracts(evm, gasLimit); err != nil {
+		return nil, err
+	}
+	return evm, nil
+}
+
+// upgradeViewCall is a view of the rehearsal suite, calls with args are repeated for every active validator
+type upgradeViewCall struct {
+	contract  common.Address
+	signature string
+	args      func(validator, owner common.Address) []interface{}
+}
+
+func byValidator(validator, _ common.Address) []interface{} {
+	return []interface{}{validator}
+}
+
+func byOwner(_, owner common.Address) []interface{} {
+	return []interface{}{owner}
+}
+
+func byValidatorAndOwner(validator, owner common.Address) []interface{} {
+	return []interface{}{validator, owner}
+}
+
+var upgradeViewCalls = []upgradeViewCall{
+	{contract: stakingAddress, signature: "currentEpoch()(uint64)"},
+	{contract: stakingAddress, signature: "nextEpoch()(uint64)"},
+	{contract: stakingAddress, signature: "getValidators()(address[])"},
+	{contract: stakingAddress, signature: "isValidatorActive(address)(bool)", args: byValidator},
+	{contract: stakingAddress, signature: "getValidatorStatus(address)(address,uint8,uint256,uint32,uint64,uint64,uint64,uint16,uint96)", args: byValidator},
+	{contract: stakingAddress, signature: "getValidatorByOwner(address)(address)", args: byOwner},
+	{contract: stakingAddress, signature: "getValidatorDelegation(address,address)(uint256,uint64)", args: byValidatorAndOwner},
+	{contract: stakingAddress, signature: "getValidatorFee(address)(uint256)", args: byValidator},
+	{contract: stakingAddress, signature: "getPendingValidatorFee(address)(uint256)", args: byValidator},
+	{contract: stakingAddress, signature: "getDelegatorFee(address,address)(uint256)", args: byValidatorAndOwner},
+	{contract: stakingAddress, signature: "getPendingDelegatorFee(address,address)(uint256)", args: byValidatorAndOwner},
+	{contract: systemRewardAddress, signature: "getSystemFee()(uint256)"},
+	{contract: stakingPoolAddress, signature: "getRatio(address)(uint256)", args: byValidator},
+	{contract: stakingPoolAddress, signature: "getStakedAmount(address,address)(uint256)", args: byValidatorAndOwner},
+	{contract: stakingPoolAddress, signature: "claimableRewards(address,address)(uint256)", args: byValidatorAndOwner},
+	{contract: governanceAddress, signature: "getVotingSupply()(uint256)"},
+	{contract: governanceAddress, signature: "votingPeriod()(uint256)"},
+	{contract: governanceAddress, signature: "isRegistryActivated()(bool)"},
+	{contract: governanceAddress, signature: "getVotingPower(address)(uint256)", args: byOwner},
+	{contract: governanceAddress, signature: "isProposer(address)(bool)", args: byOwner},
+	{contract: chainConfigAddress, signature: "getActiveValidatorsLength()(uint32)"},
+	{contract: chainConfigAddress, signature: "getEpochBlockInterval()(uint32)"},
+	{contract: chainConfigAddress, signature: "getMisdemeanorThreshold()(uint32)"},
+	{contract: chainConfigAddress, signature: "getFelonyThreshold()(uint32)"},
+	{contract: chainConfigAddress, signature: "getValidatorJailEpochLength()(uint32)"},
+	{contract: chainConfigAddress, signature: "getUndelegatePeriod()(uint32)"},
+	{contract: chainConfigAddress, signature: "getMinValidatorStakeAmount()(uint256)"},
+	{contract: chainConfigAddress, signature: "getMinStakingAmount()(uint256)"},
+	{contract: runtimeUpgradeAddress, signature: "getEvmHookAddress()(address)"},
+	{contract: runtimeUpgradeAddress, signature: "getSystemContracts()(address[])"},
+	{contract: deployerProxyAddress, signature: "isDeployer(address)(bool)", args: byOwner},
+	{contract: deployerProxyAddress, signature: "isBanned(address)(bool)", args: byOwner},
+}
+
+// viewResult is a formatted result of the view call, reverted views keep the error
+type viewResult struct {
+	name     string
+	result   string
+	reverted bool
+}
+
+// runViewSuite executes all views, validators and owners are taken before the upgrade, so the same calls
+// are made after it
+func runViewSuite(evm *vm.EVM, validators, owners []common.Address) []viewResult {
+	var results []viewResult
+	run := func(call upgradeViewCall, args []interface{}) {
+		name := fmt.Sprintf("%s %s", call.contract.Hex(), call.signature)
+		if len(args) > 0 {
+			name += " " + formatValues(args)
+		}
+		result, err := viewCall(evm, call.contract, call.signature, args...)
+		if err != nil {
+			results = append(results, viewResult{name: name, result: err.Error(), reverted: true})
+			return
+		}
+		results = append(results, viewResult{name: name, result: formatValues(result)})
+	}
+	for _, contract := range systemContracts {
+		run(upgradeViewCall{contract: contract, signature: "isInitialized()(bool)"}, nil)
+	}
+	for _, call := range upgradeViewCalls {
+		if call.args == nil {
+			run(call, nil)
+			continue
+		}
+		for i, validator := range validators {
+			run(call, call.args(validator, owners[i]))
+		}
+	}
+	return results
+}
+
+// systemContractUpgrade is a system contract artifact that can be applied by RuntimeUpgrade
+type systemContractUpgrade struct {
+	name        string
+	address     common.Address
+	rawArtifact []byte
+}
+
+// upgradableSystemContracts returns all system contracts, RuntimeUpgrade is included because it's in its own
+// getSystemContracts list and can be upgraded the same way
+func upgradableSystemContracts(artifacts *systemArtifacts) []systemContractUpgrade {
+	return []systemContractUpgrade{
+		{"Staking", stakingAddress, artifacts.Staking},
+		{"SlashingIndicator", slashingIndicatorAddress, artifacts.SlashingIndicator},
+		{"SystemReward", systemRewardAddress, artifacts.SystemReward},
+		{"StakingPool", stakingPoolAddress, artifacts.StakingPool},
+		{"Governance", governanceAddress, artifacts.Governance},
+		{"ChainConfig", chainConfigAddress, artifacts.ChainConfig},
+		{"RuntimeUpgrade", runtimeUpgradeAddress, artifacts.RuntimeUpgrade},
+		{"DeployerProxy", deployerProxyAddress, artifacts.DeployerProxy},
+	}
+}
+
+// deployedBytecode returns runtime bytecode of the artifact
+func (u systemContractUpgrade) deployedBytecode() ([]byte, error) {
+	artifact := &artifactData{}
+	if err := json.Unmarshal(u.rawArtifact, artifact); err != nil {
+		return nil, err
+	}
+	deployedBytecode, err := hexutil.Decode(artifact.DeployedBytecode)
+	if err != nil {
+		return nil, fmt.Errorf("bad %s deployed bytecode: %w", u.name, err)
+	}
+	return deployedBytecode, nil
+}
+
+// applyRuntimeUpgrades replaces bytecode of system contracts the same way as the RuntimeUpgrade EVM hook
+// does and calls init if contract is not initialized
+func applyRuntimeUpgrades(evm *vm.EVM, opts buildOptions) ([]string, error) {
+	artifacts, err := loadSystemArtifacts(opts)
+	if err != nil {
+		return nil, err
+	}
+	var upgraded []string
+	for _, upgrade := range upgradableSystemContracts(artifacts) {
+		deployedBytecode, err := upgrade.deployedBytecode()
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(evm.StateDB.GetCode(upgrade.address), deployedBytecode) {
+			continue
+		}
+		evm.StateDB.SetCode(upgrade.address, deployedBytecode)
+		result, err := viewCall(evm, upgrade.address, "isInitialized()(bool)")
+		if err != nil {
+			return nil, err
+		}
+		if !result[0].(bool) {
+			if output, _, err := evm.Call(vm.AccountRef(runtimeUpgradeAddress), upgrade.address, initFunctionSelector, opts.GasLimit, big.NewInt(0)); err != nil {
+				return nil, fmt.Errorf("%s init failed: %s", upgrade.name, formatCallError(output, err))
+			}
+		}
+		upgraded = append(upgraded, upgrade.name)
+	}
+	return upgraded, nil
+}
+
+// rehearseUpgrade applies new system contracts bytecode on top of the network state dump and compares
+// results of the view suite before and after the upgrade
+func rehearseUpgrade(args []string, opts buildOptions) error {
+	flags := flag.NewFlagSet("rehearse-upgrade", flag.ExitOnError)
+	blockNumber := flags.Uint64("block", 0, "block number the dump was made at (views depend on the current epoch)")
+	blockTime := flags.Uint64("time", 0, "timestamp of the block the dump was made at")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 2 {
+		return fmt.Errorf("usage: rehearse-upgrade [--block N] [--time T] <genesis.json> <dump.json>")
+	}
+	evm, err := newStateDumpEVM(flags.Arg(0), flags.Arg(1), *blockNumber, *blockTime, opts.GasLimit)
+	if err != nil {
+		return err
+	}
+	result, err := viewCall(evm, stakingAddress, "getValidators()(address[])")
+	if err != nil {
+		return err
+	}
+	validators := result[0].([]common.Address)
+	var owners []common.Address
+	for _, validator := range validators {
+		status, err := viewCall(evm, stakingAddress, "getValidatorStatus(address)(address,uint8,uint256,uint32,uint64,uint64,uint64,uint16,uint96)", validator)
+		if err != nil {
+			return err
+		}
+		owners = append(owners, status[0].(common.Address))
+	}
+	before := runViewSuite(evm, validators, owners)
+	upgraded, err := applyRuntimeUpgrades(evm, opts)
+	if err != nil {
+		return err
+	}
+	if len(upgraded) == 0 {
+		fmt.Printf("bytecode of all system contracts is the same, nothing to upgrade\n")
+		return nil
+	}
+	fmt.Printf("upgraded: %s\n", strings.Join(upgraded, ", "))
+	after := runViewSuite(evm, validators, owners)
+	var changed, reverted int
+	for i := range before {
+		if before[i].result == after[i].result {
+			continue
+		}
+		if after[i].reverted && !before[i].reverted {
+			fmt.Printf(" - reverts: %s\n   %s\n", before[i].name, after[i].result)
+			reverted++
+			continue
+		}
+		fmt.Printf(" ~ changed: %s\n   before: %s\n   after:  %s\n", before[i].name, before[i].result, after[i].result)
+		changed++
+	}
+	fmt.Printf("views: total=%d changed=%d reverted=%d\n", len(before), changed, reverted)
+	if reverted > 0 {
+		return fmt.Errorf("%d views revert after the upgrade", reverted)
+	}
+	return nil
+}
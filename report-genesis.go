@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const defaultSystemContractGasLimit = 10_000_000
+
+type deploymentStats struct {
+	ContractName  string
+	Address       common.Address
+	CreateGasUsed uint64
+	InitGasUsed   uint64
+	CodeSize      int
+	InitCodeSize  int
+	// decoded logs emitted by the constructor and init call
+	Events []genesisEvent
+}
+
+func (s *deploymentStats) String() string {
+	return fmt.Sprintf("create gas=%d init gas=%d code size=%d/%d (%.1f%% of EIP-170) init code size=%d/%d (%.1f%% of EIP-3860)",
+		s.CreateGasUsed, s.InitGasUsed,
+		s.CodeSize, params.MaxCodeSize, float64(s.CodeSize)*100/float64(params.MaxCodeSize),
+		s.InitCodeSize, params.MaxInitCodeSize, float64(s.InitCodeSize)*100/float64(params.MaxInitCodeSize))
+}
+
+// describeDeploymentError turns EVM errors into human-readable ones, otherwise it's hard to say why deployment failed
+func describeDeploymentError(contractName, stage string, gasLimit uint64, result []byte, err error) error {
+	switch {
+	case errors.Is(err, vm.ErrOutOfGas), errors.Is(err, vm.ErrCodeStoreOutOfGas):
+		return fmt.Errorf("%s %s ran out of gas (gas limit is %d, use --gas-limit to increase it): %w", contractName, stage, gasLimit, err)
+	case errors.Is(err, vm.ErrMaxCodeSizeExceeded):
+		return fmt.Errorf("%s deployed code size is %d bytes, it exceeds EIP-170 limit of %d bytes: %w", contractName, len(result), params.MaxCodeSize, err)
+	case errors.Is(err, vm.ErrExecutionReverted):
+		return fmt.Errorf("%s %s reverted: %s", contractName, stage, formatCallError(result, err))
+	}
+	return fmt.Errorf("%s %s failed: %w", contractName, stage, err)
+}
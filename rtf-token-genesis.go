@@ -0,0 +1,72 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+)
+
+//go:embed build/contracts/RTFToken.json
+var rtfTokenRawArtifact []byte
+
+type rtfTokenMint struct {
+	To      common.Address        `json:"to"`
+	TokenId *math.HexOrDecimal256 `json:"tokenId"`
+	URI     string                `json:"uri"`
+}
+
+// rtfTokenConfig describes RTFToken collection that exists from block 0, owner gets admin, minter and burner roles
+// and all tokens are minted by the owner inside genesis simulation
+type rtfTokenConfig struct {
+	Address common.Address `json:"address"`
+	Name    string         `json:"name"`
+	Symbol  string         `json:"symbol"`
+	BaseURI string         `json:"baseUri"`
+	Owner   common.Address `json:"owner"`
+	Mints   []rtfTokenMint `json:"mints"`
+}
+
+func deployRTFToken(genesis *core.Genesis, config *rtfTokenConfig, silent bool, opts buildOptions) (*deploymentStats, error) {
+	if config.Owner == (common.Address{}) {
+		return nil, fmt.Errorf("rtf token owner is not specified")
+	}
+	if err := checkAllocConflict(genesis, config.Address, "rtf token"); err != nil {
+		return nil, err
+	}
+	artifact := &artifactData{}
+	if err := json.Unmarshal(rtfTokenRawArtifact, artifact); err != nil {
+		return nil, err
+	}
+	constructor, err := artifact.ABI.Pack("", config.Name, config.Symbol, config.BaseURI)
+	if err != nil {
+		return nil, err
+	}
+	var calls []simulatedCall
+	for _, mint := range config.Mints {
+		if mint.TokenId == nil {
+			return nil, fmt.Errorf("rtf token mint to %s doesn't have token id", mint.To.Hex())
+		}
+		input, err := artifact.ABI.Pack("mint", mint.To, (*big.Int)(mint.TokenId), mint.URI)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, simulatedCall{Stage: fmt.Sprintf("mint-%s", (*big.Int)(mint.TokenId)), From: config.Owner, Input: input})
+	}
+	stats, err := simulateContract(genesis, config.Address, config.Owner, rtfTokenRawArtifact, constructor, big.NewInt(0), calls, opts)
+	if err != nil {
+		return stats, err
+	}
+	// contracts are created with nonce 1 (EIP-161)
+	account := genesis.Alloc[config.Address]
+	account.Nonce = 1
+	genesis.Alloc[config.Address] = account
+	if !silent {
+		fmt.Printf(" + predeployed %s: address=%s owner=%s minted=%d %s\n", stats.ContractName, config.Address.Hex(), config.Owner.Hex(), len(config.Mints), stats)
+	}
+	return stats, nil
+}
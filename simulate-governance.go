@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"create-genesis/extradata"
+)
+
+// proposalStates are names of Governor.ProposalState values
+var proposalStates = []string{"Pending", "Active", "Canceled", "Defeated", "Succeeded", "Queued", "Expired", "Executed"}
+
+const (
+	proposalStateActive    = 1
+	proposalStateSucceeded = 4
+	proposalStateExecuted  = 7
+)
+
+// proposalScenario describes proposal and votes, by default the owner of the first active validator proposes
+// and all validator owners vote for (support: 0 - against, 1 - for, 2 - abstain)
+type proposalScenario struct {
+	Proposer    *common.Address          `json:"proposer"`
+	Description string                   `json:"description"`
+	Actions     []proposalAction         `json:"actions"`
+	Votes       map[common.Address]uint8 `json:"votes"`
+	// custom voting period in blocks (proposeWithCustomVotingPeriod)
+	VotingPeriod uint64                                   `json:"votingPeriod"`
+	Fund         map[common.Address]*math.HexOrDecimal256 `json:"fund"`
+	// calls executed before the proposal is created (register validators, delegate etc)
+	Calls []bootstrapCall `json:"calls"`
+}
+
+type governanceSimulator struct {
+	*chainSimulator
+	abis       map[common.Address]abi.ABI
+	proposalId *big.Int
+	state      uint8
+}
+
+// advance produces the next block by the in-turn validator and reports proposal state transitions
+func (s *governanceSimulator) advance() error {
+	validators, err := s.activeValidators()
+	if err != nil {
+		return err
+	}
+	if len(validators) == 0 {
+		return fmt.Errorf("validator set is empty at block %d", s.blockNumber())
+	}
+	extradata.SortValidators(validators)
+	s.nextBlock(validators[(s.blockNumber()+1)%uint64(len(validators))])
+	return s.trackState()
+}
+
+func (s *governanceSimulator) trackState() error {
+	if s.proposalId == nil {
+		return nil
+	}
+	result, err := viewCall(s.evm, governanceAddress, "state(uint256)(uint8)", s.proposalId)
+	if err != nil {
+		return err
+	}
+	if state := result[0].(uint8); state != s.state {
+		fmt.Printf("block %d: %s -> %s\n", s.blockNumber(), proposalStates[s.state], proposalStates[state])
+		s.state = state
+	}
+	return nil
+}
+
+func (s *governanceSimulator) printEvents() {
+	for _, log := range s.newLogs() {
+		contractAbi, ok := s.abis[log.Address]
+		if !ok {
+			fmt.Printf(" + log: address=%s topics=%d\n", log.Address.Hex(), len(log.Topics))
+			continue
+		}
+		event, args := unpackEvent(contractAbi, log)
+		if event == nil {
+			fmt.Printf(" + log: address=%s topics=%d\n", log.Address.Hex(), len(log.Topics))
+			continue
+		}
+		var names []string
+		for name := range args {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var values []interface{}
+		for _, name := range names {
+			values = append(values, args[name])
+		}
+		fmt.Printf(" + event: address=%s %s %v %s\n", log.Address.Hex(), event.Name, names, formatValues(values))
+	}
+}
+
+// printStateChanges compares modified accounts with the state before execution
+func (s *governanceSimulator) printStateChanges(before *state.StateDB) {
+	addresses := readStateObjectAddressesFromState(s.statedb)
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i][:], addresses[j][:]) < 0
+	})
+	for _, address := range addresses {
+		if prev, next := before.GetBalance(address), s.statedb.GetBalance(address); prev.Cmp(next) != 0 {
+			fmt.Printf(" + balance: address=%s %s -> %s\n", address.Hex(), prev, next)
+		}
+		if prev, next := before.GetCodeHash(address), s.statedb.GetCodeHash(address); prev != next {
+			fmt.Printf(" + code: address=%s %s -> %s\n", address.Hex(), prev.Hex(), next.Hex())
+		}
+		storage := readDirtyStorageFromState(s.statedb.GetOrNewStateObject(address))
+		var keys []common.Hash
+		for key := range storage {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return bytes.Compare(keys[i][:], keys[j][:]) < 0
+		})
+		for _, key := range keys {
+			if prev, next := before.GetState(address, key), s.statedb.GetState(address, key); prev != next {
+				fmt.Printf(" + storage: address=%s slot=%s %s -> %s\n", address.Hex(), key.Hex(), prev.Hex(), next.Hex())
+			}
+		}
+	}
+}
+
+func simulateGovernance(genesisFile, scenarioFile string) error {
+	genesis, err := loadGenesisFile(genesisFile)
+	if err != nil {
+		return err
+	}
+	var scenario proposalScenario
+	if err := loadScenario(scenarioFile, &scenario); err != nil {
+		return err
+	}
+	if len(scenario.Actions) == 0 {
+		return fmt.Errorf("proposal doesn't have actions")
+	}
+	simulator, err := newChainSimulator(genesis)
+	if err != nil {
+		return err
+	}
+	abis, err := systemContractAbis()
+	if err != nil {
+		return err
+	}
+	s := &governanceSimulator{chainSimulator: simulator, abis: abis}
+	s.fund(scenario.Fund)
+	if err := s.advance(); err != nil {
+		return err
+	}
+	if err := applyBootstrapCalls(s.genesis, s.statedb, s.evm, scenario.Calls, false); err != nil {
+		return err
+	}
+	s.newLogs()
+	validators, err := s.activeValidators()
+	if err != nil {
+		return err
+	}
+	proposer := scenario.Proposer
+	if proposer == nil {
+		if len(validators) == 0 {
+			return fmt.Errorf("there are no active validators to propose")
+		}
+		owner, err := s.validatorOwner(validators[0])
+		if err != nil {
+			return err
+		}
+		proposer = &owner
+	}
+	var targets []common.Address
+	var values []*big.Int
+	var calldatas [][]byte
+	totalValue := big.NewInt(0)
+	for _, action := range scenario.Actions {
+		target, input, err := action.resolve(abis)
+		if err != nil {
+			return err
+		}
+		value := bigOrZero(action.Value)
+		targets, values, calldatas = append(targets, target), append(values, value), append(calldatas, input)
+		totalValue.Add(totalValue, value)
+	}
+	descriptionHash := crypto.Keccak256Hash([]byte(scenario.Description))
+	result, err := viewCall(s.evm, governanceAddress, "hashProposal(address[],uint256[],bytes[],bytes32)(uint256)", targets, values, calldatas, [32]byte(descriptionHash))
+	if err != nil {
+		return err
+	}
+	proposalId := result[0].(*big.Int)
+	if scenario.VotingPeriod > 0 {
+		err = s.call(*proposer, governanceAddress, big.NewInt(0), "proposeWithCustomVotingPeriod(address[],uint256[],bytes[],string,uint256)", targets, values, calldatas, scenario.Description, new(big.Int).SetUint64(scenario.VotingPeriod))
+	} else {
+		err = s.call(*proposer, governanceAddress, big.NewInt(0), "propose(address[],uint256[],bytes[],string)", targets, values, calldatas, scenario.Description)
+	}
+	if err != nil {
+		return err
+	}
+	s.proposalId = proposalId
+	fmt.Printf("block %d: proposal %s created by %s\n", s.blockNumber(), proposalId, proposer.Hex())
+	s.newLogs()
+	if err := s.trackState(); err != nil {
+		return err
+	}
+	snapshot, err := viewCall(s.evm, governanceAddress, "proposalSnapshot(uint256)(uint256)", proposalId)
+	if err != nil {
+		return err
+	}
+	deadline, err := viewCall(s.evm, governanceAddress, "proposalDeadline(uint256)(uint256)", proposalId)
+	if err != nil {
+		return err
+	}
+	quorum, err := viewCall(s.evm, governanceAddress, "quorum(uint256)(uint256)", snapshot[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf(" + snapshot=%s deadline=%s quorum=%s\n", snapshot[0], deadline[0], quorum[0])
+	for s.state != proposalStateActive {
+		if s.state != 0 {
+			return fmt.Errorf("proposal is %s before voting", proposalStates[s.state])
+		}
+		if err := s.advance(); err != nil {
+			return err
+		}
+	}
+	votes := scenario.Votes
+	if votes == nil {
+		votes = make(map[common.Address]uint8)
+		for _, validator := range validators {
+			owner, err := s.validatorOwner(validator)
+			if err != nil {
+				return err
+			}
+			votes[owner] = 1
+		}
+	}
+	var voters []common.Address
+	for voter := range votes {
+		voters = append(voters, voter)
+	}
+	sort.Slice(voters, func(i, j int) bool {
+		return bytes.Compare(voters[i][:], voters[j][:]) < 0
+	})
+	for _, voter := range voters {
+		if err := s.call(voter, governanceAddress, big.NewInt(0), "castVote(uint256,uint8)", proposalId, votes[voter]); err != nil {
+			return err
+		}
+		validator, err := viewCall(s.evm, stakingAddress, "getValidatorByOwner(address)(address)", voter)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("block %d: vote from %s (validator %s)\n", s.blockNumber(), voter.Hex(), validator[0].(common.Address).Hex())
+		s.printEvents()
+	}
+	for s.state == proposalStateActive {
+		if err := s.advance(); err != nil {
+			return err
+		}
+	}
+	proposalVotes, err := viewCall(s.evm, governanceAddress, "proposalVotes(uint256)(uint256,uint256,uint256)", proposalId)
+	if err != nil {
+		return err
+	}
+	fmt.Printf(" + votes: against=%s for=%s abstain=%s quorum=%s\n", proposalVotes[0], proposalVotes[1], proposalVotes[2], quorum[0])
+	if s.state != proposalStateSucceeded {
+		return fmt.Errorf("proposal is %s, it can't be executed", proposalStates[s.state])
+	}
+	before := s.statedb.Copy()
+	if err := s.call(*proposer, governanceAddress, totalValue, "execute(address[],uint256[],bytes[],bytes32)", targets, values, calldatas, [32]byte(descriptionHash)); err != nil {
+		return err
+	}
+	fmt.Printf("block %d: proposal executed\n", s.blockNumber())
+	s.printEvents()
+	s.printStateChanges(before)
+	return s.trackState()
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+
+	"create-genesis/extradata"
+)
+
+// rewardsScenario feeds synthetic fees through Staking.deposit from coinbase every block and claims all rewards at
+// the beginning of every epoch, all validators are online
+type rewardsScenario struct {
+	Epochs      uint64                `json:"epochs"`
+	FeePerBlock *math.HexOrDecimal256 `json:"feePerBlock"`
+	// fee transferred directly to SystemReward every block (zero by default)
+	SystemFeePerBlock *math.HexOrDecimal256                    `json:"systemFeePerBlock"`
+	Fund              map[common.Address]*math.HexOrDecimal256 `json:"fund"`
+	Calls             []scenarioCall                           `json:"calls"`
+	// accounts that claim delegator fee, validator owners claim both validator and delegator fees
+	Delegators []common.Address `json:"delegators"`
+}
+
+type rewardsSimulator struct {
+	*chainSimulator
+	scenario   rewardsScenario
+	abis       map[common.Address]abi.ABI
+	validators []common.Address
+	earnings   map[common.Address]*big.Int
+	deposited  *big.Int
+}
+
+func bigOrZero(value *math.HexOrDecimal256) *big.Int {
+	if value == nil {
+		return big.NewInt(0)
+	}
+	return (*big.Int)(value)
+}
+
+func (s *rewardsSimulator) addEarning(account common.Address, amount *big.Int) {
+	if _, ok := s.earnings[account]; !ok {
+		s.earnings[account] = big.NewInt(0)
+	}
+	s.earnings[account].Add(s.earnings[account], amount)
+}
+
+// collectEvents reads claim events of Staking and SystemReward, claimed delegator amounts include returned
+// undelegates
+func (s *rewardsSimulator) collectEvents() error {
+	for _, log := range s.newLogs() {
+		contractAbi, ok := s.abis[log.Address]
+		if !ok {
+			continue
+		}
+		event, args := unpackEvent(contractAbi, log)
+		if event == nil || args == nil {
+			continue
+		}
+		switch event.Name {
+		case "ValidatorAdded":
+			if validator := args["validator"].(common.Address); !containsAddress(s.validators, validator) {
+				s.validators = append(s.validators, validator)
+			}
+		case "ValidatorOwnerClaimed":
+			owner, err := s.validatorOwner(args["validator"].(common.Address))
+			if err != nil {
+				return err
+			}
+			s.addEarning(owner, args["amount"].(*big.Int))
+		case "Claimed":
+			s.addEarning(args["staker"].(common.Address), args["amount"].(*big.Int))
+		case "FeeClaimed":
+			s.addEarning(args["account"].(common.Address), args["amount"].(*big.Int))
+		}
+	}
+	return nil
+}
+
+func (s *rewardsSimulator) uint256Call(contract common.Address, signature string, args ...interface{}) (*big.Int, error) {
+	result, err := viewCall(s.evm, contract, signature, args...)
+	if err != nil {
+		return nil, err
+	}
+	return result[0].(*big.Int), nil
+}
+
+// claimAll claims validator, delegator and system fees for all previous epochs
+func (s *rewardsSimulator) claimAll() error {
+	for _, validator := range s.validators {
+		owner, err := s.validatorOwner(validator)
+		if err != nil {
+			return err
+		}
+		validatorFee, err := s.uint256Call(stakingAddress, "getValidatorFee(address)(uint256)", validator)
+		if err != nil {
+			return err
+		}
+		if validatorFee.Sign() > 0 {
+			if err := s.call(owner, stakingAddress, big.NewInt(0), "claimValidatorFee(address)", validator); err != nil {
+				return err
+			}
+		}
+		delegators := append([]common.Address{owner}, s.scenario.Delegators...)
+		for _, delegator := range delegators {
+			delegatorFee, err := s.uint256Call(stakingAddress, "getDelegatorFee(address,address)(uint256)", validator, delegator)
+			if err != nil {
+				return err
+			}
+			if delegatorFee.Sign() > 0 {
+				if err := s.call(delegator, stakingAddress, big.NewInt(0), "claimDelegatorFee(address)", validator); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := s.call(s.evm.Context.Coinbase, systemRewardAddress, big.NewInt(0), "claimSystemFee()"); err != nil {
+		return err
+	}
+	return s.collectEvents()
+}
+
+// produceBlock deposits fees from the coinbase the same way as the engine does at the end of the block
+func (s *rewardsSimulator) produceBlock(coinbase common.Address) error {
+	s.nextBlock(coinbase)
+	if s.isFirstEpochBlock() {
+		if err := s.applyScenarioCalls(s.scenario.Calls); err != nil {
+			return err
+		}
+		if err := s.collectEvents(); err != nil {
+			return err
+		}
+		if err := s.claimAll(); err != nil {
+			return err
+		}
+	}
+	if fee := bigOrZero(s.scenario.FeePerBlock); fee.Sign() > 0 {
+		if err := s.systemCall(stakingAddress, fee, "deposit(address)", coinbase); err != nil {
+			return err
+		}
+		s.deposited.Add(s.deposited, fee)
+	}
+	if fee := bigOrZero(s.scenario.SystemFeePerBlock); fee.Sign() > 0 {
+		s.statedb.AddBalance(coinbase, fee)
+		if _, err := executeCall(s.evm, s.statedb, coinbase, systemRewardAddress, fee, nil, s.genesis.GasLimit); err != nil {
+			return fmt.Errorf("system fee transfer at block %d failed: %w", s.blockNumber(), err)
+		}
+		s.deposited.Add(s.deposited, fee)
+	}
+	return nil
+}
+
+func (s *rewardsSimulator) printRatios() error {
+	for _, validator := range s.validators {
+		ratio, err := s.uint256Call(stakingPoolAddress, "getRatio(address)(uint256)", validator)
+		if err != nil {
+			return err
+		}
+		fmt.Printf(" + staking pool ratio: validator=%s ratio=%s\n", validator.Hex(), ratio)
+	}
+	return nil
+}
+
+func (s *rewardsSimulator) printSummary() error {
+	fmt.Printf("total deposited: %s\n", s.deposited)
+	var accounts []common.Address
+	for account := range s.earnings {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return bytes.Compare(accounts[i][:], accounts[j][:]) < 0
+	})
+	for _, account := range accounts {
+		fmt.Printf(" + earned: account=%s amount=%s\n", account.Hex(), s.earnings[account])
+	}
+	// everything that is not delegated stake is either unclaimed rewards or dust
+	totalDelegated := big.NewInt(0)
+	for _, validator := range s.validators {
+		status, err := viewCall(s.evm, stakingAddress, "getValidatorStatus(address)(address,uint8,uint256,uint32,uint64,uint64,uint64,uint16,uint96)", validator)
+		if err != nil {
+			return err
+		}
+		totalDelegated.Add(totalDelegated, status[2].(*big.Int))
+	}
+	stakingBalance := s.statedb.GetBalance(stakingAddress)
+	fmt.Printf(" + staking: balance=%s delegated=%s left=%s\n", stakingBalance, totalDelegated, new(big.Int).Sub(stakingBalance, totalDelegated))
+	systemFee, err := s.uint256Call(systemRewardAddress, "getSystemFee()(uint256)")
+	if err != nil {
+		return err
+	}
+	fmt.Printf(" + system reward: balance=%s unclaimed=%s\n", s.statedb.GetBalance(systemRewardAddress), systemFee)
+	fmt.Printf(" + staking pool: balance=%s\n", s.statedb.GetBalance(stakingPoolAddress))
+	return nil
+}
+
+func simulateRewards(genesisFile, scenarioFile string) error {
+	genesis, err := loadGenesisFile(genesisFile)
+	if err != nil {
+		return err
+	}
+	var scenario rewardsScenario
+	if err := loadScenario(scenarioFile, &scenario); err != nil {
+		return err
+	}
+	simulator, err := newChainSimulator(genesis)
+	if err != nil {
+		return err
+	}
+	simulator.fund(scenario.Fund)
+	abis, err := systemContractAbis()
+	if err != nil {
+		return err
+	}
+	validators, err := simulator.activeValidators()
+	if err != nil {
+		return err
+	}
+	s := &rewardsSimulator{
+		chainSimulator: simulator,
+		scenario:       scenario,
+		abis:           abis,
+		validators:     validators,
+		earnings:       make(map[common.Address]*big.Int),
+		deposited:      big.NewInt(0),
+	}
+	for epoch := uint64(0); epoch <= scenario.Epochs; epoch++ {
+		active, err := s.activeValidators()
+		if err != nil {
+			return err
+		}
+		if len(active) == 0 {
+			return fmt.Errorf("validator set is empty at epoch %d", epoch)
+		}
+		extradata.SortValidators(active)
+		lastBlock := (epoch+1)*s.epochLength - 1
+		// rewards of the last epoch are claimed in the first block of the next one
+		if epoch == scenario.Epochs {
+			lastBlock = epoch * s.epochLength
+		}
+		for number := s.blockNumber() + 1; number <= lastBlock; number++ {
+			if err := s.produceBlock(active[number%uint64(len(active))]); err != nil {
+				return err
+			}
+		}
+		if err := s.collectEvents(); err != nil {
+			return err
+		}
+		if epoch < scenario.Epochs {
+			fmt.Printf("epoch %d: deposited=%s\n", epoch, s.deposited)
+			if err := s.printRatios(); err != nil {
+				return err
+			}
+		}
+	}
+	return s.printSummary()
+}
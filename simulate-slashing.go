@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"create-genesis/extradata"
+)
+
+// missedBlocksPattern describes how validator misses its in-turn blocks, every Nth in-turn block is missed
+// (1 means validator is offline), the pattern is active for epochs [fromEpoch, toEpoch], zero toEpoch means forever
+type missedBlocksPattern struct {
+	Validator common.Address `json:"validator"`
+	FromEpoch uint64         `json:"fromEpoch"`
+	ToEpoch   uint64         `json:"toEpoch"`
+	Every     uint64         `json:"every"`
+}
+
+type slashingScenario struct {
+	Epochs uint64                                   `json:"epochs"`
+	Missed []missedBlocksPattern                    `json:"missed"`
+	Calls  []scenarioCall                           `json:"calls"`
+	Fund   map[common.Address]*math.HexOrDecimal256 `json:"fund"`
+	// jailed validators are released by their owners as soon as jail period ends
+	AutoRelease bool `json:"autoRelease"`
+}
+
+type epochReport struct {
+	Epoch       uint64
+	Active      []common.Address
+	Slashes     map[common.Address]uint32
+	Misdemeanor []common.Address
+	Jailed      []common.Address
+	Released    []common.Address
+	Dropped     []common.Address
+	Joined      []common.Address
+	Added       []common.Address
+}
+
+func (p *missedBlocksPattern) misses(epoch, inTurnBlock uint64) bool {
+	if p.Every == 0 || epoch < p.FromEpoch || (p.ToEpoch != 0 && epoch > p.ToEpoch) {
+		return false
+	}
+	return inTurnBlock%p.Every == 0
+}
+
+type slashingSimulator struct {
+	*chainSimulator
+	scenario     slashingScenario
+	stakingAbi   abi.ABI
+	misdemeanor  uint32
+	inTurnBlocks map[common.Address]uint64
+	validators   []common.Address
+}
+
+// applyStakingEvents adds staking events to the epoch report
+func (s *slashingSimulator) applyStakingEvents(report *epochReport, logs []*types.Log) {
+	for _, event := range decodeGenesisEvents(s.stakingAbi, "Staking", "simulation", logs) {
+		validator, _ := event.Args["validator"].(common.Address)
+		switch event.Event {
+		case "ValidatorSlashed":
+			report.Slashes[validator]++
+		case "ValidatorJailed":
+			report.Jailed = append(report.Jailed, validator)
+		case "ValidatorReleased":
+			report.Released = append(report.Released, validator)
+		case "ValidatorAdded":
+			report.Added = append(report.Added, validator)
+		}
+	}
+}
+
+// releaseJailedValidators releases validators whose jail period ends, release events are reported in the next epoch
+func (s *slashingSimulator) releaseJailedValidators() error {
+	for _, validator := range s.validators {
+		status, err := viewCall(s.evm, stakingAddress, "getValidatorStatus(address)(address,uint8,uint256,uint32,uint64,uint64,uint64,uint16,uint96)", validator)
+		if err != nil {
+			return err
+		}
+		owner, jailedBefore := status[0].(common.Address), status[5].(uint64)
+		if status[1].(uint8) != 3 || s.currentEpoch() < jailedBefore {
+			continue
+		}
+		if err := s.call(owner, stakingAddress, big.NewInt(0), "releaseValidatorFromJail(address)", validator); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runEpoch produces all blocks of the epoch, validator set is taken from the staking contract at the epoch block
+// (engine applies it with a delay, but it doesn't matter for slashing)
+func (s *slashingSimulator) runEpoch(epoch uint64, previous []common.Address) (*epochReport, error) {
+	report := &epochReport{Epoch: epoch, Slashes: make(map[common.Address]uint32)}
+	active, err := s.activeValidators()
+	if err != nil {
+		return nil, err
+	}
+	extradata.SortValidators(active)
+	report.Active = active
+	for _, validator := range previous {
+		if !containsAddress(active, validator) {
+			report.Dropped = append(report.Dropped, validator)
+		}
+	}
+	for _, validator := range active {
+		if !containsAddress(previous, validator) {
+			report.Joined = append(report.Joined, validator)
+		}
+	}
+	if len(active) == 0 {
+		return report, fmt.Errorf("validator set is empty at epoch %d", epoch)
+	}
+	for number := epoch * s.epochLength; number < (epoch+1)*s.epochLength; number++ {
+		if number == 0 {
+			continue
+		}
+		inTurn := active[number%uint64(len(active))]
+		s.inTurnBlocks[inTurn]++
+		missed := false
+		for _, pattern := range s.scenario.Missed {
+			if pattern.Validator == inTurn && pattern.misses(epoch, s.inTurnBlocks[inTurn]) {
+				missed = true
+			}
+		}
+		if !missed {
+			s.nextBlock(inTurn)
+		} else {
+			// block is produced by the next validator that is online, in-turn validator is slashed by the engine
+			var producer *common.Address
+			for i := 1; i < len(active); i++ {
+				candidate := active[(number+uint64(i))%uint64(len(active))]
+				offline := false
+				for _, pattern := range s.scenario.Missed {
+					if pattern.Validator == candidate && pattern.Every == 1 && pattern.misses(epoch, 1) {
+						offline = true
+					}
+				}
+				if !offline {
+					producer = &candidate
+					break
+				}
+			}
+			if producer == nil {
+				return report, fmt.Errorf("chain halted at block %d, all validators are offline", number)
+			}
+			s.nextBlock(*producer)
+			if err := s.systemCall(slashingIndicatorAddress, big.NewInt(0), "slash(address)", inTurn); err != nil {
+				return report, err
+			}
+		}
+		if s.isFirstEpochBlock() {
+			if err := s.applyScenarioCalls(s.scenario.Calls); err != nil {
+				return report, err
+			}
+		}
+	}
+	s.applyStakingEvents(report, s.newLogs())
+	s.validators = append(s.validators, report.Added...)
+	for validator, slashes := range report.Slashes {
+		if slashes >= s.misdemeanor {
+			report.Misdemeanor = append(report.Misdemeanor, validator)
+		}
+	}
+	if s.scenario.AutoRelease {
+		if err := s.releaseJailedValidators(); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (r *epochReport) print() {
+	fmt.Printf("epoch %d: active=%s\n", r.Epoch, formatAddresses(r.Active))
+	var slashes []string
+	for validator, count := range r.Slashes {
+		slashes = append(slashes, fmt.Sprintf("%s=%d", validator.Hex(), count))
+	}
+	for _, line := range []struct {
+		name  string
+		value string
+		empty bool
+	}{
+		{"joined", formatAddresses(r.Joined), len(r.Joined) == 0},
+		{"dropped", formatAddresses(r.Dropped), len(r.Dropped) == 0},
+		{"registered", formatAddresses(r.Added), len(r.Added) == 0},
+		{"slashed", "[" + strings.Join(slashes, ", ") + "]", len(slashes) == 0},
+		{"misdemeanor", formatAddresses(r.Misdemeanor), len(r.Misdemeanor) == 0},
+		{"jailed", formatAddresses(r.Jailed), len(r.Jailed) == 0},
+		{"released", formatAddresses(r.Released), len(r.Released) == 0},
+	} {
+		if !line.empty {
+			fmt.Printf(" + %s: %s\n", line.name, line.value)
+		}
+	}
+}
+
+func simulateSlashing(genesisFile, scenarioFile string) error {
+	genesis, err := loadGenesisFile(genesisFile)
+	if err != nil {
+		return err
+	}
+	var scenario slashingScenario
+	if err := loadScenario(scenarioFile, &scenario); err != nil {
+		return err
+	}
+	simulator, err := newChainSimulator(genesis)
+	if err != nil {
+		return err
+	}
+	simulator.fund(scenario.Fund)
+	stakingArtifact := &artifactData{}
+	if err := json.Unmarshal(stakingRawArtifact, stakingArtifact); err != nil {
+		return err
+	}
+	result, err := viewCall(simulator.evm, chainConfigAddress, "getMisdemeanorThreshold()(uint32)")
+	if err != nil {
+		return err
+	}
+	validators, err := simulator.activeValidators()
+	if err != nil {
+		return err
+	}
+	s := &slashingSimulator{
+		chainSimulator: simulator,
+		scenario:       scenario,
+		stakingAbi:     stakingArtifact.ABI,
+		misdemeanor:    result[0].(uint32),
+		inTurnBlocks:   make(map[common.Address]uint64),
+		validators:     validators,
+	}
+	previous := validators
+	for epoch := uint64(0); epoch < scenario.Epochs; epoch++ {
+		report, err := s.runEpoch(epoch, previous)
+		if report != nil {
+			report.print()
+		}
+		if err != nil {
+			return err
+		}
+		previous = report.Active
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// chainSimulator runs initialized genesis state block by block without consensus engine, it only changes block
+// context (number, time and coinbase) and executes calls the same way as engine or users do
+type chainSimulator struct {
+	genesis     *core.Genesis
+	statedb     *state.StateDB
+	evm         *vm.EVM
+	epochLength uint64
+	blockPeriod uint64
+	seenLogs    int
+}
+
+func loadGenesisFile(path string) (*core.Genesis, error) {
+	fileContents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	genesis := &core.Genesis{}
+	if err := json.Unmarshal(fileContents, genesis); err != nil {
+		return nil, err
+	}
+	if genesis.Config == nil || genesis.Config.Parlia == nil {
+		return nil, fmt.Errorf("genesis (%s) doesn't have Parlia config", path)
+	}
+	return genesis, nil
+}
+
+func newChainSimulator(genesis *core.Genesis) (*chainSimulator, error) {
+	statedb, evm, err := newInitializedGenesisState(genesis, defaultSystemContractGasLimit)
+	if err != nil {
+		return nil, err
+	}
+	result, err := viewCall(evm, chainConfigAddress, "getEpochBlockInterval()(uint32)")
+	if err != nil {
+		return nil, err
+	}
+	epochLength := uint64(result[0].(uint32))
+	if epochLength == 0 {
+		return nil, fmt.Errorf("epoch block interval is zero")
+	}
+	simulator := &chainSimulator{genesis: genesis, statedb: statedb, evm: evm, epochLength: epochLength, blockPeriod: genesis.Config.Parlia.Period}
+	// logs emitted by init calls are not interesting for simulations
+	simulator.newLogs()
+	return simulator, nil
+}
+
+func (s *chainSimulator) blockNumber() uint64 {
+	return s.evm.Context.BlockNumber.Uint64()
+}
+
+func (s *chainSimulator) currentEpoch() uint64 {
+	return s.blockNumber() / s.epochLength
+}
+
+// nextBlock moves simulation to the next block produced by the coinbase
+func (s *chainSimulator) nextBlock(coinbase common.Address) {
+	number := s.blockNumber() + 1
+	s.evm.Context.BlockNumber = new(big.Int).SetUint64(number)
+	s.evm.Context.Time = s.genesis.Timestamp + number*s.blockPeriod
+	s.evm.Context.Coinbase = coinbase
+}
+
+// systemCall executes call from coinbase with zero gas price, it's how the engine calls system contracts
+func (s *chainSimulator) systemCall(contract common.Address, value *big.Int, signature string, args ...interface{}) error {
+	method, err := parseMethodSignature(signature)
+	if err != nil {
+		return err
+	}
+	input, err := method.Inputs.Pack(args...)
+	if err != nil {
+		return err
+	}
+	if value.Sign() > 0 {
+		s.statedb.AddBalance(s.evm.Context.Coinbase, value)
+	}
+	if _, err := executeCall(s.evm, s.statedb, s.evm.Context.Coinbase, contract, value, append(method.ID, input...), s.genesis.GasLimit); err != nil {
+		return fmt.Errorf("%s at block %d failed: %w", signature, s.blockNumber(), err)
+	}
+	return nil
+}
+
+// call executes a regular transaction from the account
+func (s *chainSimulator) call(from, contract common.Address, value *big.Int, signature string, args ...interface{}) error {
+	method, err := parseMethodSignature(signature)
+	if err != nil {
+		return err
+	}
+	input, err := method.Inputs.Pack(args...)
+	if err != nil {
+		return err
+	}
+	if _, err := executeCall(s.evm, s.statedb, from, contract, value, append(method.ID, input...), s.genesis.GasLimit); err != nil {
+		return fmt.Errorf("%s from %s at block %d failed: %w", signature, from.Hex(), s.blockNumber(), err)
+	}
+	return nil
+}
+
+// newLogs returns logs emitted since the previous call in the order of emission
+func (s *chainSimulator) newLogs() []*types.Log {
+	logs := s.statedb.Logs()
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].Index < logs[j].Index
+	})
+	result := logs[s.seenLogs:]
+	s.seenLogs = len(logs)
+	return result
+}
+
+func (s *chainSimulator) activeValidators() ([]common.Address, error) {
+	result, err := viewCall(s.evm, stakingAddress, "getValidators()(address[])")
+	if err != nil {
+		return nil, err
+	}
+	return result[0].([]common.Address), nil
+}
+
+func (s *chainSimulator) validatorOwner(validator common.Address) (common.Address, error) {
+	status, err := viewCall(s.evm, stakingAddress, "getValidatorStatus(address)(address,uint8,uint256,uint32,uint64,uint64,uint64,uint16,uint96)", validator)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return status[0].(common.Address), nil
+}
+
+// systemContractAbis returns ABIs of system contracts by their addresses, it's used to decode emitted logs
+func systemContractAbis() (map[common.Address]abi.ABI, error) {
+	rawArtifacts := map[common.Address][]byte{
+		stakingAddress:           stakingRawArtifact,
+		slashingIndicatorAddress: slashingIndicatorRawArtifact,
+		systemRewardAddress:      systemRewardRawArtifact,
+		stakingPoolAddress:       stakingPoolRawArtifact,
+		governanceAddress:        governanceRawArtifact,
+		chainConfigAddress:       chainConfigRawArtifact,
+		runtimeUpgradeAddress:    runtimeUpgradeRawArtifact,
+		deployerProxyAddress:     deployerProxyRawArtifact,
+	}
+	result := make(map[common.Address]abi.ABI)
+	for address, rawArtifact := range rawArtifacts {
+		artifact := &artifactData{}
+		if err := json.Unmarshal(rawArtifact, artifact); err != nil {
+			return nil, err
+		}
+		result[address] = artifact.ABI
+	}
+	return result, nil
+}
+
+// scenarioCall is a transaction executed at the first block of the epoch (registerValidator, delegate etc)
+type scenarioCall struct {
+	Epoch uint64 `json:"epoch"`
+	bootstrapCall
+}
+
+func loadScenario(path string, scenario interface{}) error {
+	fileContents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(fileContents, scenario)
+}
+
+func formatAddresses(addresses []common.Address) string {
+	var result []string
+	for _, address := range addresses {
+		result = append(result, address.Hex())
+	}
+	return "[" + strings.Join(result, ", ") + "]"
+}
+
+func containsAddress(addresses []common.Address, address common.Address) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *chainSimulator) fund(balances map[common.Address]*math.HexOrDecimal256) {
+	for address, amount := range balances {
+		s.statedb.AddBalance(address, (*big.Int)(amount))
+	}
+}
+
+// isFirstEpochBlock returns true for the first block of the epoch that can be simulated (genesis is skipped)
+func (s *chainSimulator) isFirstEpochBlock() bool {
+	number := s.blockNumber()
+	return number%s.epochLength == 0 || number == 1
+}
+
+// applyScenarioCalls executes calls scheduled for the current epoch
+func (s *chainSimulator) applyScenarioCalls(calls []scenarioCall) error {
+	for _, call := range calls {
+		if call.Epoch != s.currentEpoch() {
+			continue
+		}
+		_, input, err := packMethodCall(call.Method, call.Args)
+		if err != nil {
+			return err
+		}
+		value := big.NewInt(0)
+		if call.Value != nil {
+			value = (*big.Int)(call.Value)
+		}
+		if _, err := executeCall(s.evm, s.statedb, call.From, call.To, value, input, s.genesis.GasLimit); err != nil {
+			return fmt.Errorf("scenario call %s at epoch %d failed: %w", call.Method, s.currentEpoch(), err)
+		}
+	}
+	return nil
+}
+
+// runSimulation runs scenario of the given kind against the genesis file
+func runSimulation(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: simulate <slashing|rewards|governance> <genesis.json> <scenario.json>")
+	}
+	switch args[0] {
+	case "slashing":
+		return simulateSlashing(args[1], args[2])
+	case "rewards":
+		return simulateRewards(args[1], args[2])
+	case "governance":
+		return simulateGovernance(args[1], args[2])
+	}
+	return fmt.Errorf("unknown simulation: %s", args[0])
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/consensus/parlia"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// smokeNode is an in-memory node with the forked Parlia engine, blocks are built and sealed manually with the
+// in-turn validator key, so one node can produce blocks for all validators
+type smokeNode struct {
+	stack       *node.Node
+	backend     *eth.Ethereum
+	engine      *parlia.Parlia
+	ks          *keystore.KeyStore
+	sealTimeout time.Duration
+}
+
+func newSmokeNode(genesis *core.Genesis, ks *keystore.KeyStore, sealTimeout time.Duration) (*smokeNode, error) {
+	stack, err := node.New(&node.Config{
+		P2P: p2p.Config{NoDiscovery: true, MaxPeers: 0, ListenAddr: ""},
+	})
+	if err != nil {
+		return nil, err
+	}
+	config := ethconfig.Defaults
+	config.Genesis = genesis
+	config.NetworkId = genesis.Config.ChainID.Uint64()
+	backend, err := eth.New(stack, &config)
+	if err != nil {
+		stack.Close()
+		return nil, err
+	}
+	engine, ok := backend.Engine().(*parlia.Parlia)
+	if !ok {
+		stack.Close()
+		return nil, fmt.Errorf("genesis doesn't use Parlia consensus engine")
+	}
+	if err := stack.Start(); err != nil {
+		stack.Close()
+		return nil, err
+	}
+	return &smokeNode{stack: stack, backend: backend, engine: engine, ks: ks, sealTimeout: sealTimeout}, nil
+}
+
+func (n *smokeNode) authorize(validator common.Address) {
+	n.engine.Authorize(validator, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return n.ks.SignData(account, mimeType, data)
+	}, func(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+		return n.ks.SignTx(account, tx, chainID)
+	})
+}
+
+// signedRecently checks the same rule as Parlia.Seal, a validator that has signed one of the last len/2+1 blocks
+// can't seal and Seal silently returns without a block
+func (n *smokeNode) signedRecently(parent *types.Header, validator common.Address) (bool, error) {
+	number := rpc.BlockNumber(parent.Number.Int64())
+	var api *parlia.API
+	for _, service := range n.engine.APIs(n.backend.BlockChain()) {
+		if parliaApi, ok := service.Service.(*parlia.API); ok {
+			api = parliaApi
+		}
+	}
+	if api == nil {
+		return false, fmt.Errorf("Parlia API is not available")
+	}
+	snap, err := api.GetSnapshot(&number)
+	if err != nil {
+		return false, err
+	}
+	next, limit := parent.Number.Uint64()+1, uint64(len(snap.Validators)/2+1)
+	for seen, recent := range snap.Recents {
+		if recent == validator && (next < limit || seen > next-limit) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// prepareHeader finds validator that is in turn (or any validator with the key if in-turn key is missing),
+// validators that have signed recently are skipped
+func (n *smokeNode) prepareHeader(parent *types.Header) (*types.Header, error) {
+	chain := n.backend.BlockChain()
+	var outOfTurn *types.Header
+	var lastErr error
+	for _, account := range n.ks.Accounts() {
+		if recently, err := n.signedRecently(parent, account.Address); err != nil {
+			return nil, err
+		} else if recently {
+			lastErr = fmt.Errorf("%s has signed recently", account.Address.Hex())
+			continue
+		}
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number, common.Big1),
+			GasLimit:   core.CalcGasLimit(parent.GasLimit, parent.GasLimit),
+		}
+		if chain.Config().IsLondon(header.Number) {
+			header.BaseFee = misc.CalcBaseFee(chain.Config(), parent)
+		}
+		n.authorize(account.Address)
+		if err := n.engine.Prepare(chain, header); err != nil {
+			lastErr = err
+			continue
+		}
+		if header.Difficulty.Cmp(big.NewInt(2)) == 0 {
+			return header, nil
+		} else if outOfTurn == nil {
+			outOfTurn = header
+		}
+	}
+	if outOfTurn != nil {
+		n.authorize(outOfTurn.Coinbase)
+		return outOfTurn, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("keystore is empty")
+	}
+	return nil, fmt.Errorf("none of the validators can seal block %d: %w", parent.Number.Uint64()+1, lastErr)
+}
+
+// produceBlock builds, seals and inserts the next block, failed system transactions are returned as errors
+func (n *smokeNode) produceBlock() (*types.Block, []string, error) {
+	chain := n.backend.BlockChain()
+	parent := chain.CurrentHeader()
+	header, err := n.prepareHeader(parent)
+	if err != nil {
+		return nil, nil, err
+	}
+	statedb, err := chain.StateAt(parent.Root)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, receipts, err := n.engine.FinalizeAndAssemble(chain, header, statedb, []*types.Transaction{}, nil, []*types.Receipt{}, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("block %d finalization failed: %w", header.Number.Uint64(), err)
+	}
+	var failures []string
+	for i, receipt := range receipts {
+		if receipt.Status == types.ReceiptStatusFailed {
+			tx := block.Transactions()[i]
+			failures = append(failures, fmt.Sprintf("block %d system tx %s to %s failed", block.NumberU64(), tx.Hash().Hex(), tx.To().Hex()))
+		}
+	}
+	results := make(chan *types.Block, 1)
+	stop := make(chan struct{})
+	if err := n.engine.Seal(chain, block, results, stop); err != nil {
+		return nil, failures, fmt.Errorf("block %d sealing failed: %w", block.NumberU64(), err)
+	}
+	// Seal returns nil without a block if it refuses to seal, so the result isn't awaited forever
+	var sealed *types.Block
+	select {
+	case sealed = <-results:
+	case <-time.After(n.sealTimeout):
+		close(stop)
+		return nil, failures, fmt.Errorf("block %d isn't sealed by %s in %s", block.NumberU64(), block.Coinbase().Hex(), n.sealTimeout)
+	}
+	if _, err := chain.InsertChain(types.Blocks{sealed}); err != nil {
+		return nil, failures, fmt.Errorf("block %d is rejected: %w", sealed.NumberU64(), err)
+	}
+	return sealed, failures, nil
+}
+
+// readPasswordFile reads keystore password, trailing new line is ignored
+func readPasswordFile(passwordFile string) (string, error) {
+	rawPassword, err := os.ReadFile(passwordFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(rawPassword), "\r\n"), nil
+}
+
+func loadUnlockedKeystore(keystoreDir, passwordFile string) (*keystore.KeyStore, error) {
+	password, err := readPasswordFile(passwordFile)
+	if err != nil {
+		return nil, err
+	}
+	ks := keystore.NewKeyStore(keystoreDir, keystore.StandardScryptN, keystore.StandardScryptP)
+	for _, account := range ks.Accounts() {
+		if err := ks.Unlock(account, password); err != nil {
+			return nil, fmt.Errorf("failed to unlock %s: %w", account.Address.Hex(), err)
+		}
+	}
+	return ks, nil
+}
+
+// runSmokeTest produces blocks of the genesis past at least two epoch boundaries, it fails on the first consensus
+// error, but system transaction failures are collected and reported at the end
+func runSmokeTest(args []string) error {
+	flags := flag.NewFlagSet("smoke", flag.ExitOnError)
+	keystoreDir := flags.String("keystore", "./keystore", "keystore directory with validator keys")
+	passwordFile := flags.String("password", "./password.txt", "password file for the keystore")
+	period := flags.Uint64("period", 1, "block period used for the smoke test (genesis hash doesn't depend on it)")
+	blocks := flags.Uint64("blocks", 0, "number of blocks to produce (two epochs and one block by default, it takes a period per block)")
+	sealTimeout := flags.Duration("seal-timeout", 30*time.Second, "max time to wait for a sealed block")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 {
+		return fmt.Errorf("usage: smoke [--keystore DIR] [--password FILE] [--period N] [--blocks N] <genesis.json>")
+	}
+	fileContents, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	genesis := &core.Genesis{}
+	if err := json.Unmarshal(fileContents, genesis); err != nil {
+		return err
+	}
+	if genesis.Config == nil || genesis.Config.Parlia == nil {
+		return fmt.Errorf("genesis doesn't have Parlia config")
+	}
+	if genesis.Config.Parlia.Epoch == 0 {
+		return fmt.Errorf("genesis has zero Parlia epoch")
+	}
+	if *period == 0 {
+		return fmt.Errorf("Parlia period must be at least 1 second")
+	}
+	genesis.Config.Parlia.Period = *period
+	if *blocks == 0 {
+		*blocks = 2*genesis.Config.Parlia.Epoch + 1
+	}
+	// blocks are sealed in real time, so long epochs take long, --blocks limits it
+	fmt.Printf("producing %d blocks, it takes about %s\n", *blocks, time.Duration(*blocks**period)*time.Second)
+	ks, err := loadUnlockedKeystore(*keystoreDir, *passwordFile)
+	if err != nil {
+		return err
+	}
+	smoke, err := newSmokeNode(genesis, ks, *sealTimeout)
+	if err != nil {
+		return err
+	}
+	defer smoke.stack.Close()
+	var failures []string
+	for i := uint64(0); i < *blocks; i++ {
+		block, blockFailures, err := smoke.produceBlock()
+		failures = append(failures, blockFailures...)
+		if err != nil {
+			failures = append(failures, err.Error())
+			break
+		}
+		if block.NumberU64()%genesis.Config.Parlia.Epoch == 0 {
+			fmt.Printf(" + epoch block %d: miner=%s txs=%d\n", block.NumberU64(), block.Coinbase().Hex(), len(block.Transactions()))
+		} else {
+			fmt.Printf(" + block %d: miner=%s txs=%d\n", block.NumberU64(), block.Coinbase().Hex(), len(block.Transactions()))
+		}
+	}
+	if len(failures) > 0 {
+		for _, failure := range failures {
+			fmt.Printf(" ! %s\n", failure)
+		}
+		return fmt.Errorf("smoke test failed with %d error(s)", len(failures))
+	}
+	fmt.Printf("smoke test passed, produced %d blocks\n", *blocks)
+	return nil
+}
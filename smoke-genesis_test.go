@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// bootstrap calls commit initialized system contracts into genesis, the engine calls init() once again in the
+// first block, such genesis must still produce blocks and keep the committed state
+func TestSmokeBootstrappedGenesis(t *testing.T) {
+	key, err := crypto.HexToECDSA(testValidatorKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	config := localNetConfig
+	config.Deployers = nil
+	config.Validators = []common.Address{owner}
+	config.SystemTreasury = map[common.Address]uint16{owner: 10000}
+	config.InitialStakes = map[common.Address]string{owner: "0x3635c9adc5dea00000"}
+	config.Faucet = map[common.Address]string{owner: "0x21e19e0c9bab2400000"}
+	config.Bootstrap = []bootstrapCall{{
+		From:   owner,
+		To:     stakingAddress,
+		Value:  (*math.HexOrDecimal256)(hexutil.MustDecodeBig("0x56bc75e2d63100000")),
+		Method: "delegate(address)",
+		Args:   jsonArgs(owner),
+	}}
+	genesisFile := filepath.Join(t.TempDir(), "genesis.json")
+	if err := createGenesisConfig(config, genesisFile, buildOptions{GasLimit: defaultSystemContractGasLimit, ArtifactOverrides: artifactOverrides{}}); err != nil {
+		t.Fatal(err)
+	}
+	genesis, err := loadGenesisFile(genesisFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Initializable flag of the system contracts is set in genesis
+	if genesis.Alloc[stakingAddress].Storage[common.Hash{}] == (common.Hash{}) {
+		t.Fatalf("staking isn't initialized in genesis")
+	}
+	genesis.Config.Parlia.Period = 1
+	ks := keystore.NewKeyStore(t.TempDir(), keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.ImportECDSA(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Unlock(account, ""); err != nil {
+		t.Fatal(err)
+	}
+	smoke, err := newSmokeNode(genesis, ks, 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer smoke.stack.Close()
+	for i := 0; i < 3; i++ {
+		_, failures, err := smoke.produceBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(failures) > 0 {
+			t.Fatalf("system transactions failed: %v", failures)
+		}
+	}
+	statedb, err := smoke.backend.BlockChain().State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// init() in the first block must not change (or re-run constructors of) the initialized contracts
+	for _, contract := range systemContracts {
+		for slot, value := range genesis.Alloc[contract].Storage {
+			if current := statedb.GetState(contract, slot); current != value {
+				t.Fatalf("%s slot %s is changed from %s to %s", contract.Hex(), slot.Hex(), value.Hex(), current.Hex())
+			}
+		}
+	}
+}
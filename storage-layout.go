@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// storageLayoutContracts are system contracts upgraded in place by RuntimeUpgrade
+var storageLayoutContracts = []string{"Staking", "SlashingIndicator", "SystemReward", "StakingPool", "Governance", "ChainConfig", "RuntimeUpgrade", "DeployerProxy"}
+
+// storageVariable is an entry of the solc storageLayout output
+type storageVariable struct {
+	Label    string `json:"label"`
+	Contract string `json:"contract"`
+	Slot     string `json:"slot"`
+	Offset   uint64 `json:"offset"`
+	Type     string `json:"type"`
+}
+
+type storageType struct {
+	Encoding      string            `json:"encoding"`
+	Label         string            `json:"label"`
+	NumberOfBytes string            `json:"numberOfBytes"`
+	Base          string            `json:"base"`
+	Key           string            `json:"key"`
+	Value         string            `json:"value"`
+	Members       []storageVariable `json:"members"`
+}
+
+type storageLayout struct {
+	Storage []storageVariable      `json:"storage"`
+	Types   map[string]storageType `json:"types"`
+}
+
+// readStorageLayout reads solc storageLayout output, artifacts with the storageLayout field (hardhat) are
+// supported too
+func readStorageLayout(path string) (*storageLayout, error) {
+	fileContents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var artifact struct {
+		StorageLayout *storageLayout `json:"storageLayout"`
+		storageLayout
+	}
+	if err := json.Unmarshal(fileContents, &artifact); err != nil {
+		return nil, fmt.Errorf("failed to parse storage layout (%s): %w", path, err)
+	}
+	if artifact.StorageLayout != nil {
+		return artifact.StorageLayout, nil
+	}
+	if artifact.Types == nil && len(artifact.Storage) == 0 {
+		return nil, fmt.Errorf("file (%s) doesn't have storage layout", path)
+	}
+	return &artifact.storageLayout, nil
+}
+
+// describeType returns type description without AST ids, because ids are changed by every compilation
+func (l *storageLayout) describeType(id string) string {
+	return l.describeTypeOnce(id, make(map[string]bool))
+}
+
+// describeTypeOnce stops on recursive structs (struct can have a mapping to itself)
+func (l *storageLayout) describeTypeOnce(id string, seen map[string]bool) string {
+	t, ok := l.Types[id]
+	if !ok {
+		return id
+	}
+	description := fmt.Sprintf("%s(%s)", t.Label, t.NumberOfBytes)
+	if seen[id] {
+		return description
+	}
+	seen[id] = true
+	defer delete(seen, id)
+	switch {
+	case t.Key != "":
+		description += fmt.Sprintf("[%s=>%s]", l.describeTypeOnce(t.Key, seen), l.describeTypeOnce(t.Value, seen))
+	case t.Base != "":
+		description += fmt.Sprintf("[%s]", l.describeTypeOnce(t.Base, seen))
+	case len(t.Members) > 0:
+		var members []string
+		for _, member := range t.Members {
+			members = append(members, fmt.Sprintf("%s@%s+%d:%s", member.Label, member.Slot, member.Offset, l.describeTypeOnce(member.Type, seen)))
+		}
+		description += "{" + strings.Join(members, ",") + "}"
+	}
+	return description
+}
+
+// slots returns the number of slots occupied by the variable
+func (l *storageLayout) slots(variable storageVariable) *big.Int {
+	size, ok := new(big.Int).SetString(l.Types[variable.Type].NumberOfBytes, 10)
+	if !ok {
+		return big.NewInt(1)
+	}
+	size.Add(size, big.NewInt(31))
+	return size.Div(size, big.NewInt(32))
+}
+
+func parseSlot(slot string) *big.Int {
+	result, ok := new(big.Int).SetString(slot, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return result
+}
+
+func isStorageGap(variable storageVariable) bool {
+	return strings.HasPrefix(variable.Label, "__reserved") || strings.HasPrefix(variable.Label, "__gap")
+}
+
+// storageVariableKey identifies variable by the declaring contract, because base contracts (e.g.
+// InjectorContextHolder and OpenZeppelin) might use the same names
+func storageVariableKey(variable storageVariable) string {
+	contract := variable.Contract
+	if i := strings.LastIndex(contract, ":"); i >= 0 {
+		contract = contract[i+1:]
+	}
+	return contract + "." + variable.Label
+}
+
+// compareStorageLayouts returns incompatible changes and notes (compatible changes like appended
+// variables or gaps consumed by new variables)
+func compareStorageLayouts(prev, next *storageLayout) (problems, notes []string) {
+	nextVariables := make(map[string]storageVariable)
+	for _, variable := range next.Storage {
+		nextVariables[storageVariableKey(variable)] = variable
+	}
+	prevVariables := make(map[string]bool)
+	for _, variable := range prev.Storage {
+		key := storageVariableKey(variable)
+		prevVariables[key] = true
+		nextVariable, ok := nextVariables[key]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s is removed (slot %s)", key, variable.Slot))
+			continue
+		}
+		if isStorageGap(variable) {
+			// gap can shrink to give space to new variables, but it must end at the same slot
+			prevEnd := new(big.Int).Add(parseSlot(variable.Slot), prev.slots(variable))
+			nextEnd := new(big.Int).Add(parseSlot(nextVariable.Slot), next.slots(nextVariable))
+			if prevEnd.Cmp(nextEnd) != 0 {
+				problems = append(problems, fmt.Sprintf("%s ends at slot %s instead of %s", key, nextEnd, prevEnd))
+			} else if prev.slots(variable).Cmp(next.slots(nextVariable)) != 0 {
+				notes = append(notes, fmt.Sprintf("%s size is changed from %s to %s slots", key, prev.slots(variable), next.slots(nextVariable)))
+			}
+			continue
+		}
+		if variable.Slot != nextVariable.Slot || variable.Offset != nextVariable.Offset {
+			problems = append(problems, fmt.Sprintf("%s is moved from slot %s+%d to %s+%d", key, variable.Slot, variable.Offset, nextVariable.Slot, nextVariable.Offset))
+		}
+		if prevType, nextType := prev.describeType(variable.Type), next.describeType(nextVariable.Type); prevType != nextType {
+			problems = append(problems, fmt.Sprintf("%s is retyped from %s to %s", key, prevType, nextType))
+		}
+	}
+	for _, variable := range next.Storage {
+		if key := storageVariableKey(variable); !prevVariables[key] {
+			notes = append(notes, fmt.Sprintf("%s is added (slot %s+%d)", key, variable.Slot, variable.Offset))
+		}
+	}
+	return problems, notes
+}
+
+// checkStorageLayouts compares storage layouts of all system contracts (<dir>/<Contract>.json), error is
+// returned if any upgrade is incompatible
+func checkStorageLayouts(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: storage-layout <old-layouts-dir> <new-layouts-dir>")
+	}
+	var incompatible int
+	for _, contractName := range storageLayoutContracts {
+		prev, err := readStorageLayout(filepath.Join(args[0], contractName+".json"))
+		if err != nil {
+			return err
+		}
+		next, err := readStorageLayout(filepath.Join(args[1], contractName+".json"))
+		if err != nil {
+			return err
+		}
+		problems, notes := compareStorageLayouts(prev, next)
+		status := "compatible"
+		if len(problems) > 0 {
+			status = "incompatible"
+		}
+		fmt.Printf("%s: %s\n", contractName, status)
+		for _, problem := range problems {
+			fmt.Printf(" - %s\n", problem)
+		}
+		for _, note := range notes {
+			fmt.Printf(" + %s\n", note)
+		}
+		incompatible += len(problems)
+	}
+	if incompatible > 0 {
+		return fmt.Errorf("found %d incompatible storage changes", incompatible)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestStorageLayout(variables ...storageVariable) *storageLayout {
+	return &storageLayout{
+		Storage: variables,
+		Types: map[string]storageType{
+			"t_address":                      {Encoding: "inplace", Label: "address", NumberOfBytes: "20"},
+			"t_uint256":                      {Encoding: "inplace", Label: "uint256", NumberOfBytes: "32"},
+			"t_uint64":                       {Encoding: "inplace", Label: "uint64", NumberOfBytes: "8"},
+			"t_array(t_uint256)50_storage":   {Encoding: "inplace", Label: "uint256[50]", NumberOfBytes: "1600", Base: "t_uint256"},
+			"t_array(t_uint256)48_storage":   {Encoding: "inplace", Label: "uint256[48]", NumberOfBytes: "1536", Base: "t_uint256"},
+			"t_mapping(t_address,t_uint256)": {Encoding: "mapping", Label: "mapping(address => uint256)", NumberOfBytes: "32", Key: "t_address", Value: "t_uint256"},
+			"t_mapping(t_address,t_uint64)":  {Encoding: "mapping", Label: "mapping(address => uint64)", NumberOfBytes: "32", Key: "t_address", Value: "t_uint64"},
+			"t_array(t_uint256)dyn_storage":  {Encoding: "dynamic_array", Label: "uint256[]", NumberOfBytes: "32", Base: "t_uint256"},
+			"t_array(t_address)dyn_storage":  {Encoding: "dynamic_array", Label: "address[]", NumberOfBytes: "32", Base: "t_address"},
+		},
+	}
+}
+
+func testStorageVariable(label, slot string, offset uint64, typeId string) storageVariable {
+	return storageVariable{Label: label, Contract: "contracts/Staking.sol:Staking", Slot: slot, Offset: offset, Type: typeId}
+}
+
+func assertStorageMessages(t *testing.T, kind string, messages []string, expected ...string) {
+	t.Helper()
+	if len(messages) != len(expected) {
+		t.Fatalf("expected %d %s, got %v", len(expected), kind, messages)
+	}
+	for i, substring := range expected {
+		if !strings.Contains(messages[i], substring) {
+			t.Fatalf("%s #%d: expected %q, got %q", kind, i, substring, messages[i])
+		}
+	}
+}
+
+func TestCompareStorageLayoutsCompatible(t *testing.T) {
+	prev := newTestStorageLayout(
+		testStorageVariable("_owner", "0", 0, "t_address"),
+		testStorageVariable("_balances", "1", 0, "t_mapping(t_address,t_uint256)"),
+		testStorageVariable("__reserved", "2", 0, "t_array(t_uint256)50_storage"),
+	)
+	// new variables consume two slots of the gap, the gap still ends at slot 52
+	next := newTestStorageLayout(
+		testStorageVariable("_owner", "0", 0, "t_address"),
+		testStorageVariable("_balances", "1", 0, "t_mapping(t_address,t_uint256)"),
+		testStorageVariable("_total", "2", 0, "t_uint256"),
+		testStorageVariable("_items", "3", 0, "t_array(t_uint256)dyn_storage"),
+		testStorageVariable("__reserved", "4", 0, "t_array(t_uint256)48_storage"),
+	)
+	problems, notes := compareStorageLayouts(prev, next)
+	assertStorageMessages(t, "problems", problems)
+	assertStorageMessages(t, "notes", notes,
+		"Staking.__reserved size is changed from 50 to 48 slots",
+		"Staking._total is added (slot 2+0)",
+		"Staking._items is added (slot 3+0)",
+	)
+}
+
+func TestCompareStorageLayoutsMovedAndRemoved(t *testing.T) {
+	prev := newTestStorageLayout(
+		testStorageVariable("_owner", "0", 0, "t_address"),
+		testStorageVariable("_paused", "1", 0, "t_uint256"),
+		testStorageVariable("_balances", "2", 0, "t_mapping(t_address,t_uint256)"),
+	)
+	next := newTestStorageLayout(
+		testStorageVariable("_owner", "0", 0, "t_address"),
+		testStorageVariable("_balances", "1", 0, "t_mapping(t_address,t_uint256)"),
+	)
+	problems, _ := compareStorageLayouts(prev, next)
+	assertStorageMessages(t, "problems", problems,
+		"Staking._paused is removed (slot 1)",
+		"Staking._balances is moved from slot 2+0 to 1+0",
+	)
+}
+
+func TestCompareStorageLayoutsRetyped(t *testing.T) {
+	prev := newTestStorageLayout(
+		testStorageVariable("_balances", "0", 0, "t_mapping(t_address,t_uint256)"),
+		testStorageVariable("_validators", "1", 0, "t_array(t_address)dyn_storage"),
+	)
+	next := newTestStorageLayout(
+		testStorageVariable("_balances", "0", 0, "t_mapping(t_address,t_uint64)"),
+		testStorageVariable("_validators", "1", 0, "t_array(t_uint256)dyn_storage"),
+	)
+	problems, _ := compareStorageLayouts(prev, next)
+	assertStorageMessages(t, "problems", problems,
+		"Staking._balances is retyped from mapping(address => uint256)(32)[address(20)=>uint256(32)] to mapping(address => uint64)(32)[address(20)=>uint64(8)]",
+		"Staking._validators is retyped from address[](32)[address(20)] to uint256[](32)[uint256(32)]",
+	)
+}
+
+func TestCompareStorageLayoutsGapShrinkWithoutVariables(t *testing.T) {
+	prev := newTestStorageLayout(
+		testStorageVariable("_owner", "0", 0, "t_address"),
+		testStorageVariable("__gap", "1", 0, "t_array(t_uint256)50_storage"),
+	)
+	// gap is shrunk, but nothing takes its place, so variables of derived contracts would be shifted
+	next := newTestStorageLayout(
+		testStorageVariable("_owner", "0", 0, "t_address"),
+		testStorageVariable("__gap", "1", 0, "t_array(t_uint256)48_storage"),
+	)
+	problems, _ := compareStorageLayouts(prev, next)
+	assertStorageMessages(t, "problems", problems, "Staking.__gap ends at slot 49 instead of 51")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+
+	// registers native tracers (callTracer, prestateTracer and muxTracer)
+	_ "github.com/ethereum/go-ethereum/eth/tracers/native"
+)
+
+// callTracer shows call tree of the execution and prestateTracer (in diff mode) shows exactly what storage slots were modified
+var systemContractTracerConfig = json.RawMessage(`{"callTracer":{},"prestateTracer":{"diffMode":true}}`)
+
+// newSystemContractTracer creates a tracer for system contract deployment, nil is returned if tracing is disabled
+func newSystemContractTracer(opts buildOptions) (tracers.Tracer, error) {
+	if opts.TraceDir == "" {
+		return nil, nil
+	}
+	return tracers.DefaultDirectory.New("muxTracer", new(tracers.Context), systemContractTracerConfig)
+}
+
+// newTracedVmConfig enables tracing, EVM traces all calls if the tracer is set (there is no Debug flag since 1.11)
+func newTracedVmConfig(tracer tracers.Tracer) vm.Config {
+	if tracer == nil {
+		return vm.Config{}
+	}
+	return vm.Config{Tracer: tracer}
+}
+
+// writeSystemContractTrace saves tracer result to the trace directory, traces are grouped by chain id because
+// presets are built at once and contract names are the same for all networks
+func writeSystemContractTrace(opts buildOptions, genesis *core.Genesis, contractName, stage string, tracer tracers.Tracer) error {
+	if tracer == nil {
+		return nil
+	}
+	result, err := tracer.GetResult()
+	if err != nil {
+		return err
+	}
+	traceDir := filepath.Join(opts.TraceDir, genesis.Config.ChainID.String())
+	if err := os.MkdirAll(traceDir, os.ModePerm); err != nil {
+		return err
+	}
+	var formatted bytes.Buffer
+	if err := json.Indent(&formatted, result, "", "  "); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(traceDir, fmt.Sprintf("%s.%s.json", contractName, stage)), formatted.Bytes(), fs.ModePerm)
+}
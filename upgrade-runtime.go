@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// upgradeBackend is a node used by the upgrade command, both ethclient and the simulated backend implement it
+type upgradeBackend interface {
+	bind.ContractBackend
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// upgradeAction is a RuntimeUpgrade call of the proposal
+type upgradeAction struct {
+	Contract        string         `json:"contract"`
+	Address         common.Address `json:"address"`
+	Method          string         `json:"method"`
+	CurrentCodeHash common.Hash    `json:"currentCodeHash"`
+	NewCodeHash     common.Hash    `json:"newCodeHash"`
+	Calldata        hexutil.Bytes  `json:"calldata"`
+	code            []byte
+}
+
+// upgradePlan is a single proposal that upgrades all changed system contracts, it's exported as JSON for review
+type upgradePlan struct {
+	ChainId         *math.HexOrDecimal256 `json:"chainId"`
+	Proposer        common.Address        `json:"proposer"`
+	Voters          []common.Address      `json:"voters"`
+	Description     string                `json:"description"`
+	DescriptionHash common.Hash           `json:"descriptionHash"`
+	ProposalId      *math.HexOrDecimal256 `json:"proposalId"`
+	Actions         []upgradeAction       `json:"actions"`
+	ProposeCalldata hexutil.Bytes         `json:"proposeCalldata"`
+}
+
+func (p *upgradePlan) proposal() (targets []common.Address, values []*big.Int, calldatas [][]byte) {
+	for _, action := range p.Actions {
+		targets, values, calldatas = append(targets, runtimeUpgradeAddress), append(values, big.NewInt(0)), append(calldatas, action.Calldata)
+	}
+	return targets, values, calldatas
+}
+
+type runtimeUpgrader struct {
+	backend upgradeBackend
+	ks      *keystore.KeyStore
+	chainId *big.Int
+	// gas limit of transactions (estimated if zero) and gas price (suggested by the node if nil)
+	gasLimit uint64
+	gasPrice *big.Int
+	// wait is called between polls of receipts and proposal state, tests with the simulated backend
+	// commit a block here
+	wait func(ctx context.Context) error
+}
+
+func pollEvery(interval time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+			return nil
+		}
+	}
+}
+
+func (u *runtimeUpgrader) call(ctx context.Context, from, contract common.Address, signature string, args ...interface{}) ([]interface{}, error) {
+	method, err := parseMethodSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	input, err := method.Inputs.Pack(args...)
+	if err != nil {
+		return nil, err
+	}
+	output, err := u.backend.CallContract(ctx, ethereum.CallMsg{From: from, To: &contract, Data: append(method.ID, input...)}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", method.Sig, err)
+	}
+	return method.Outputs.Unpack(output)
+}
+
+func (u *runtimeUpgrader) waitMined(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	for {
+		receipt, err := u.backend.TransactionReceipt(ctx, txHash)
+		if err == nil {
+			return receipt, nil
+		} else if !errors.Is(err, ethereum.NotFound) {
+			return nil, err
+		}
+		if err := u.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sendTransaction signs transaction with the keystore key and waits for the receipt, gas estimation fails
+// if transaction reverts, so nothing is sent in this case
+func (u *runtimeUpgrader) sendTransaction(ctx context.Context, from, to common.Address, signature string, args ...interface{}) error {
+	method, err := parseMethodSignature(signature)
+	if err != nil {
+		return err
+	}
+	packed, err := method.Inputs.Pack(args...)
+	if err != nil {
+		return err
+	}
+	input := append(method.ID, packed...)
+	nonce, err := u.backend.PendingNonceAt(ctx, from)
+	if err != nil {
+		return err
+	}
+	gasLimit := u.gasLimit
+	if gasLimit == 0 {
+		if gasLimit, err = u.backend.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &to, Data: input}); err != nil {
+			return fmt.Errorf("%s from %s failed: %w", method.Sig, from.Hex(), err)
+		}
+	}
+	gasPrice := u.gasPrice
+	if gasPrice == nil {
+		if gasPrice, err = u.backend.SuggestGasPrice(ctx); err != nil {
+			return err
+		}
+	}
+	tx, err := u.ks.SignTx(accounts.Account{Address: from}, types.NewTransaction(nonce, to, big.NewInt(0), gasLimit, gasPrice, input), u.chainId)
+	if err != nil {
+		return err
+	}
+	if err := u.backend.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	fmt.Printf(" ~ %s from %s: %s\n", method.Name, from.Hex(), tx.Hash().Hex())
+	receipt, err := u.waitMined(ctx, tx.Hash())
+	if err != nil {
+		return err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("%s transaction (%s) failed", method.Sig, tx.Hash().Hex())
+	}
+	return nil
+}
+
+// proposalState returns state of the proposal, false is returned if proposal doesn't exist
+func (u *runtimeUpgrader) proposalState(ctx context.Context, proposalId *big.Int) (uint8, bool, error) {
+	if result, err := u.call(ctx, common.Address{}, governanceAddress, "proposalSnapshot(uint256)(uint256)", proposalId); err != nil {
+		return 0, false, err
+	} else if result[0].(*big.Int).Sign() == 0 {
+		return 0, false, nil
+	}
+	result, err := u.call(ctx, common.Address{}, governanceAddress, "state(uint256)(uint8)", proposalId)
+	if err != nil {
+		return 0, false, err
+	}
+	return result[0].(uint8), true, nil
+}
+
+// defaultUpgradeDescription is derived from the new code, so the same upgrade always has the same proposal id
+// and an interrupted upgrade is resumed without an explicit description
+func defaultUpgradeDescription(actions []upgradeAction) string {
+	codeHashes := make([]string, 0, len(actions))
+	for _, action := range actions {
+		codeHashes = append(codeHashes, fmt.Sprintf("%s=%s", action.Address.Hex(), action.NewCodeHash.Hex()))
+	}
+	sort.Strings(codeHashes)
+	return fmt.Sprintf("Runtime upgrade of system smart contracts (%s)", strings.Join(codeHashes, ", "))
+}
+
+// buildPlan compares on-chain code of system contracts with artifacts, contracts from deploys are deployed
+// at new addresses, active validator owners with keys in the keystore vote for the proposal. Description
+// is derived from the new code if empty
+func (u *runtimeUpgrader) buildPlan(ctx context.Context, upgrades, deploys []systemContractUpgrade, description string) (*upgradePlan, error) {
+	plan := &upgradePlan{ChainId: (*math.HexOrDecimal256)(u.chainId)}
+	addAction := func(upgrade systemContractUpgrade, method string) error {
+		newCode, err := upgrade.deployedBytecode()
+		if err != nil {
+			return err
+		}
+		currentCode, err := u.backend.CodeAt(ctx, upgrade.address, nil)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(currentCode, newCode) {
+			return nil
+		}
+		signature := method + "(address,bytes,bytes)"
+		calldataMethod, err := parseMethodSignature(signature)
+		if err != nil {
+			return err
+		}
+		input, err := calldataMethod.Inputs.Pack(upgrade.address, newCode, []byte{})
+		if err != nil {
+			return err
+		}
+		plan.Actions = append(plan.Actions, upgradeAction{
+			Contract:        upgrade.name,
+			Address:         upgrade.address,
+			Method:          method,
+			CurrentCodeHash: crypto.Keccak256Hash(currentCode),
+			NewCodeHash:     crypto.Keccak256Hash(newCode),
+			Calldata:        append(calldataMethod.ID, input...),
+			code:            newCode,
+		})
+		return nil
+	}
+	for _, upgrade := range upgrades {
+		if err := addAction(upgrade, "upgradeSystemSmartContract"); err != nil {
+			return nil, err
+		}
+	}
+	for _, deploy := range deploys {
+		if err := addAction(deploy, "deploySystemSmartContract"); err != nil {
+			return nil, err
+		}
+	}
+	if len(plan.Actions) == 0 {
+		return plan, nil
+	}
+	if description == "" {
+		description = defaultUpgradeDescription(plan.Actions)
+	}
+	plan.Description, plan.DescriptionHash = description, crypto.Keccak256Hash([]byte(description))
+	result, err := u.call(ctx, common.Address{}, stakingAddress, "getValidators()(address[])")
+	if err != nil {
+		return nil, err
+	}
+	for _, validator := range result[0].([]common.Address) {
+		status, err := u.call(ctx, common.Address{}, stakingAddress, "getValidatorStatus(address)(address,uint8,uint256,uint32,uint64,uint64,uint64,uint16,uint96)", validator)
+		if err != nil {
+			return nil, err
+		}
+		if owner := status[0].(common.Address); u.ks.HasAddress(owner) {
+			plan.Voters = append(plan.Voters, owner)
+		} else {
+			fmt.Fprintf(os.Stderr, "WARNING: keystore doesn't have key of validator %s owner (%s)\n", validator.Hex(), owner.Hex())
+		}
+	}
+	if len(plan.Voters) == 0 {
+		return nil, fmt.Errorf("keystore doesn't have keys of active validator owners")
+	}
+	plan.Proposer = plan.Voters[0]
+	targets, values, calldatas := plan.proposal()
+	result, err = u.call(ctx, common.Address{}, governanceAddress, "hashProposal(address[],uint256[],bytes[],bytes32)(uint256)", targets, values, calldatas, [32]byte(plan.DescriptionHash))
+	if err != nil {
+		return nil, err
+	}
+	plan.ProposalId = (*math.HexOrDecimal256)(result[0].(*big.Int))
+	proposeMethod, err := parseMethodSignature("propose(address[],uint256[],bytes[],string)")
+	if err != nil {
+		return nil, err
+	}
+	input, err := proposeMethod.Inputs.Pack(targets, values, calldatas, description)
+	if err != nil {
+		return nil, err
+	}
+	plan.ProposeCalldata = append(proposeMethod.ID, input...)
+	return plan, nil
+}
+
+// dryRun checks that proposal can be created by the proposer without sending any transactions
+func (u *runtimeUpgrader) dryRun(ctx context.Context, plan *upgradePlan) error {
+	_, err := u.backend.CallContract(ctx, ethereum.CallMsg{From: plan.Proposer, To: &governanceAddress, Data: plan.ProposeCalldata}, nil)
+	if err != nil {
+		return fmt.Errorf("proposal can't be created by %s: %w", plan.Proposer.Hex(), err)
+	}
+	return nil
+}
+
+// execute creates the proposal (unless it already exists), votes, waits for the deadline and executes it, so
+// interrupted upgrade can be resumed with the same description
+func (u *runtimeUpgrader) execute(ctx context.Context, plan *upgradePlan) error {
+	proposalId := (*big.Int)(plan.ProposalId)
+	targets, values, calldatas := plan.proposal()
+	state, exists, err := u.proposalState(ctx, proposalId)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		fmt.Printf("creating proposal %s\n", proposalId)
+		if err := u.sendTransaction(ctx, plan.Proposer, governanceAddress, "propose(address[],uint256[],bytes[],string)", targets, values, calldatas, plan.Description); err != nil {
+			return err
+		}
+	}
+	for {
+		if state, _, err = u.proposalState(ctx, proposalId); err != nil {
+			return err
+		}
+		if state != 0 {
+			break
+		}
+		if err := u.wait(ctx); err != nil {
+			return err
+		}
+	}
+	if state == proposalStateActive {
+		fmt.Printf("voting for proposal %s\n", proposalId)
+		for _, voter := range plan.Voters {
+			validator, err := u.call(ctx, common.Address{}, stakingAddress, "getValidatorByOwner(address)(address)", voter)
+			if err != nil {
+				return err
+			}
+			voted, err := u.call(ctx, common.Address{}, governanceAddress, "hasVoted(uint256,address)(bool)", proposalId, validator[0])
+			if err != nil {
+				return err
+			}
+			if voted[0].(bool) {
+				continue
+			}
+			if err := u.sendTransaction(ctx, voter, governanceAddress, "castVote(uint256,uint8)", proposalId, uint8(1)); err != nil {
+				return err
+			}
+		}
+	}
+	for {
+		if state, _, err = u.proposalState(ctx, proposalId); err != nil {
+			return err
+		}
+		switch state {
+		case 0, proposalStateActive:
+			if err := u.wait(ctx); err != nil {
+				return err
+			}
+			continue
+		case proposalStateSucceeded:
+			fmt.Printf("executing proposal %s\n", proposalId)
+			if err := u.sendTransaction(ctx, plan.Proposer, governanceAddress, "execute(address[],uint256[],bytes[],bytes32)", targets, values, calldatas, [32]byte(plan.DescriptionHash)); err != nil {
+				return err
+			}
+			continue
+		case proposalStateExecuted:
+		default:
+			return fmt.Errorf("proposal is %s, upgrade failed", proposalStates[state])
+		}
+		break
+	}
+	return nil
+}
+
+// verifyUpgrade checks that code of every upgraded contract matches the artifact, code is replaced by the node
+// (RuntimeUpgrade EVM hook), so the proposal can be executed, but contracts are left untouched
+func (u *runtimeUpgrader) verifyUpgrade(ctx context.Context, plan *upgradePlan) error {
+	for _, action := range plan.Actions {
+		code, err := u.backend.CodeAt(ctx, action.Address, nil)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(code, action.code) {
+			return fmt.Errorf("%s (%s) code doesn't match artifact after upgrade", action.Contract, action.Address.Hex())
+		}
+		fmt.Printf(" + %s (%s) upgraded\n", action.Contract, action.Address.Hex())
+	}
+	return nil
+}
+
+func writeUpgradePlan(plan *upgradePlan, outputFile string) error {
+	newJson, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	if outputFile == "stdout" {
+		fmt.Printf("%s\n", newJson)
+		return nil
+	}
+	return ioutil.WriteFile(outputFile, newJson, fs.ModePerm)
+}
+
+// readDeployArtifacts reads new system contracts in the format 0xAddress=path/to/artifact.json
+func readDeployArtifacts(deploys artifactOverrides) ([]systemContractUpgrade, error) {
+	// order of actions changes the proposal id, so deploys are sorted to make the plan reproducible
+	addresses := make([]string, 0, len(deploys))
+	for address := range deploys {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(common.HexToAddress(addresses[i]).Bytes(), common.HexToAddress(addresses[j]).Bytes()) < 0
+	})
+	var result []systemContractUpgrade
+	for _, address := range addresses {
+		path := deploys[address]
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("bad deploy address: %s", address)
+		}
+		rawArtifact, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		artifact := &artifactData{}
+		if err := json.Unmarshal(rawArtifact, artifact); err != nil {
+			return nil, err
+		}
+		result = append(result, systemContractUpgrade{name: artifact.ContractName, address: common.HexToAddress(address), rawArtifact: rawArtifact})
+	}
+	return result, nil
+}
+
+// runRuntimeUpgrade upgrades system contracts of the running network through governance, it replaces
+// the interactive upgrade-runtime.js script
+func runRuntimeUpgrade(args []string, opts buildOptions) error {
+	flags := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	defaultRpc := os.Getenv("WEB3_URL")
+	if defaultRpc == "" {
+		defaultRpc = "http://127.0.0.1:8545"
+	}
+	rpcUrl := flags.String("rpc", defaultRpc, "node RPC endpoint (WEB3_URL by default)")
+	keystoreDir := flags.String("keystore", "./keystore", "keystore directory with validator owner keys")
+	passwordFile := flags.String("password", "./password.txt", "password file for the keystore")
+	chainId := flags.Uint64("chain-id", 0, "chain id used for signing (requested from the node if zero)")
+	gasLimit := flags.Uint64("gas", 0, "gas limit of transactions (estimated if zero)")
+	gasPrice := flags.Uint64("gas-price", 0, "gas price in wei (suggested by the node if zero)")
+	poll := flags.Duration("poll", 3*time.Second, "interval of receipt and proposal state polling")
+	description := flags.String("description", "", "proposal description, derived from the new code if empty (the same description resumes the existing proposal)")
+	planFile := flags.String("plan", "", "write upgrade plan as JSON into the file (stdout to print)")
+	dryRun := flags.Bool("dry-run", false, "only build and check the plan, no transactions are sent")
+	deploys := artifactOverrides{}
+	flags.Var(deploys, "deploy", "new system contract in the format 0xAddress=path/to/artifact.json (can be repeated)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	backend, err := ethclient.DialContext(ctx, *rpcUrl)
+	if err != nil {
+		return err
+	}
+	ks, err := loadUnlockedKeystore(*keystoreDir, *passwordFile)
+	if err != nil {
+		return err
+	}
+	upgrader := &runtimeUpgrader{backend: backend, ks: ks, chainId: new(big.Int).SetUint64(*chainId), gasLimit: *gasLimit, wait: pollEvery(*poll)}
+	if *chainId == 0 {
+		if upgrader.chainId, err = backend.ChainID(ctx); err != nil {
+			return err
+		}
+	}
+	if *gasPrice > 0 {
+		upgrader.gasPrice = new(big.Int).SetUint64(*gasPrice)
+	}
+	artifacts, err := loadSystemArtifacts(opts)
+	if err != nil {
+		return err
+	}
+	deployArtifacts, err := readDeployArtifacts(deploys)
+	if err != nil {
+		return err
+	}
+	plan, err := upgrader.buildPlan(ctx, upgradableSystemContracts(artifacts), deployArtifacts, *description)
+	if err != nil {
+		return err
+	}
+	if *planFile != "" {
+		if err := writeUpgradePlan(plan, *planFile); err != nil {
+			return err
+		}
+	}
+	if len(plan.Actions) == 0 {
+		fmt.Printf("bytecode of all system contracts is the same, nothing to upgrade\n")
+		return nil
+	}
+	for _, action := range plan.Actions {
+		fmt.Printf(" + %s: %s (%s) %s -> %s\n", action.Method, action.Contract, action.Address.Hex(), action.CurrentCodeHash.Hex(), action.NewCodeHash.Hex())
+	}
+	// propose can't be checked once the proposal is created, such upgrade is resumed
+	state, exists, err := upgrader.proposalState(ctx, (*big.Int)(plan.ProposalId))
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Printf("proposal %s already exists (%s), resuming\n", (*big.Int)(plan.ProposalId), proposalStates[state])
+	} else if err := upgrader.dryRun(ctx, plan); err != nil {
+		return err
+	}
+	if *dryRun {
+		return nil
+	}
+	if err := upgrader.execute(ctx, plan); err != nil {
+		return err
+	}
+	return upgrader.verifyUpgrade(ctx, plan)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const testValidatorKey = "b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291"
+
+// newTestUpgrader starts simulated chain with the genesis system contracts, the only validator is owned by
+// the test key, so it can propose and vote alone
+func newTestUpgrader(t *testing.T) (*runtimeUpgrader, *backends.SimulatedBackend, common.Address) {
+	t.Helper()
+	key, err := crypto.HexToECDSA(testValidatorKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	config := localNetConfig
+	config.Deployers = nil
+	config.Validators = []common.Address{owner}
+	config.SystemTreasury = map[common.Address]uint16{owner: 10000}
+	config.InitialStakes = map[common.Address]string{owner: "0x3635c9adc5dea00000"}
+	config.Faucet = map[common.Address]string{owner: "0x21e19e0c9bab2400000"}
+	config.VotingPeriod = 5
+	genesisFile := filepath.Join(t.TempDir(), "genesis.json")
+	if err := createGenesisConfig(config, genesisFile, buildOptions{GasLimit: defaultSystemContractGasLimit, ArtifactOverrides: artifactOverrides{}}); err != nil {
+		t.Fatal(err)
+	}
+	genesis, err := loadGenesisFile(genesisFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := backends.NewSimulatedBackend(genesis.Alloc, genesis.GasLimit)
+	t.Cleanup(func() {
+		backend.Close()
+	})
+	ks := keystore.NewKeyStore(t.TempDir(), keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.ImportECDSA(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Unlock(account, ""); err != nil {
+		t.Fatal(err)
+	}
+	upgrader := &runtimeUpgrader{
+		backend: backend,
+		ks:      ks,
+		chainId: backend.Blockchain().Config().ChainID,
+		wait: func(ctx context.Context) error {
+			backend.Commit()
+			return nil
+		},
+	}
+	// consensus engine initializes system contracts in the first block, simulated chain doesn't do it
+	for _, contract := range systemContracts {
+		if err := upgrader.sendTransaction(context.Background(), owner, contract, "init()"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return upgrader, backend, owner
+}
+
+// withChangedCode appends STOP opcode to the runtime code, code hash is changed, but behaviour isn't
+func withChangedCode(t *testing.T, rawArtifact []byte) []byte {
+	t.Helper()
+	artifact := &artifactData{}
+	if err := json.Unmarshal(rawArtifact, artifact); err != nil {
+		t.Fatal(err)
+	}
+	result, err := json.Marshal(map[string]string{
+		"contractName":     artifact.ContractName,
+		"deployedBytecode": artifact.DeployedBytecode + "00",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestRuntimeUpgradeResume(t *testing.T) {
+	ctx := context.Background()
+	upgrader, backend, owner := newTestUpgrader(t)
+	upgrades := []systemContractUpgrade{
+		{"ChainConfig", chainConfigAddress, withChangedCode(t, chainConfigRawArtifact)},
+		{"StakingPool", stakingPoolAddress, stakingPoolRawArtifact},
+	}
+	plan, err := upgrader.buildPlan(ctx, upgrades, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions) != 1 || plan.Actions[0].Address != chainConfigAddress {
+		t.Fatalf("only ChainConfig must be upgraded: %+v", plan.Actions)
+	}
+	if plan.Proposer != owner || len(plan.Voters) != 1 || plan.Voters[0] != owner {
+		t.Fatalf("bad proposer or voters: %s %v", plan.Proposer.Hex(), plan.Voters)
+	}
+	if err := upgrader.dryRun(ctx, plan); err != nil {
+		t.Fatal(err)
+	}
+	// upgrade is interrupted right after the proposal is created
+	errInterrupted := errors.New("interrupted")
+	commit, waits := upgrader.wait, 0
+	upgrader.wait = func(ctx context.Context) error {
+		if waits++; waits > 1 {
+			return errInterrupted
+		}
+		return commit(ctx)
+	}
+	if err := upgrader.execute(ctx, plan); !errors.Is(err, errInterrupted) {
+		t.Fatalf("expected interrupted upgrade, got %v", err)
+	}
+	upgrader.wait = commit
+	// default description is derived from the new code, so the same proposal is resumed instead of being created once again
+	resumed, err := upgrader.buildPlan(ctx, upgrades, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposalId := (*big.Int)(resumed.ProposalId)
+	if proposalId.Cmp((*big.Int)(plan.ProposalId)) != 0 {
+		t.Fatalf("proposal id is changed: %s != %s", proposalId, (*big.Int)(plan.ProposalId))
+	}
+	if _, exists, err := upgrader.proposalState(ctx, proposalId); err != nil {
+		t.Fatal(err)
+	} else if !exists {
+		t.Fatalf("proposal %s doesn't exist", proposalId)
+	}
+	if err := upgrader.dryRun(ctx, resumed); err == nil {
+		t.Fatalf("existing proposal can't be proposed again")
+	}
+	if err := upgrader.execute(ctx, resumed); err != nil {
+		t.Fatal(err)
+	}
+	state, _, err := upgrader.proposalState(ctx, proposalId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != proposalStateExecuted {
+		t.Fatalf("proposal is %s", proposalStates[state])
+	}
+	// simulated chain doesn't have the EVM hook that replaces code, so only RuntimeUpgrade event is checked
+	logs, err := backend.FilterLogs(ctx, ethereum.FilterQuery{
+		Addresses: []common.Address{runtimeUpgradeAddress},
+		Topics:    [][]common.Hash{{crypto.Keccak256Hash([]byte("SmartContractUpgrade(address,bytes)"))}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected single upgrade event, got %d", len(logs))
+	}
+}
+
+func TestReadDeployArtifactsOrder(t *testing.T) {
+	dir := t.TempDir()
+	deploys := artifactOverrides{}
+	for i, address := range []string{"0x0000000000000000000000000000000000007009", "0x0000000000000000000000000000000000007006", "0x0000000000000000000000000000000000007008", "0x0000000000000000000000000000000000007007"} {
+		path := filepath.Join(dir, address+".json")
+		if err := os.WriteFile(path, []byte(`{"contractName":"Contract`+string(rune('A'+i))+`"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		deploys[address] = path
+	}
+	// map iteration order is random, so it's checked several times
+	for i := 0; i < 10; i++ {
+		result, err := readDeployArtifacts(deploys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, expected := range []string{"0x0000000000000000000000000000000000007006", "0x0000000000000000000000000000000000007007", "0x0000000000000000000000000000000000007008", "0x0000000000000000000000000000000000007009"} {
+			if result[j].address != common.HexToAddress(expected) {
+				t.Fatalf("deploy #%d: expected %s, got %s", j, expected, result[j].address.Hex())
+			}
+		}
+	}
+}
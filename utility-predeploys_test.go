@@ -0,0 +1,13 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestMulticall3CanonicalCode(t *testing.T) {
+	if codeHash := crypto.Keccak256Hash(multicall3Code); codeHash != multicall3CodeHash {
+		t.Fatalf("Multicall3 code hash is %s, canonical is %s", codeHash.Hex(), multicall3CodeHash.Hex())
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// list of system contracts in the order of initialization (the same as consensus engine does)
+var systemContracts = []common.Address{
+	stakingAddress,
+	slashingIndicatorAddress,
+	systemRewardAddress,
+	stakingPoolAddress,
+	governanceAddress,
+	chainConfigAddress,
+	runtimeUpgradeAddress,
+	deployerProxyAddress,
+}
+
+var initFunctionSelector = common.FromHex("0xe1c7392a")
+
+type genesisExpectation struct {
+	Name   string            `json:"name"`
+	To     common.Address    `json:"to"`
+	Method string            `json:"method"`
+	Args   []json.RawMessage `json:"args"`
+	Result []json.RawMessage `json:"result"`
+}
+
+// newGenesisState loads genesis allocation into in-memory state, unlike simulateSystemContract this state
+// contains all system contracts together, so cross-contract calls work as they do on chain
+func newGenesisState(genesis *core.Genesis) (*state.StateDB, error) {
+	db := state.NewDatabaseWithConfig(rawdb.NewDatabase(memorydb.New()), &trie.Config{})
+	statedb, err := state.New(common.Hash{}, db, nil)
+	if err != nil {
+		return nil, err
+	}
+	for address, account := range genesis.Alloc {
+		if account.Balance != nil {
+			statedb.SetBalance(address, account.Balance)
+		}
+		statedb.SetNonce(address, account.Nonce)
+		statedb.SetCode(address, account.Code)
+		for key, value := range account.Storage {
+			statedb.SetState(address, key, value)
+		}
+	}
+	return statedb, nil
+}
+
+// newGenesisEVM creates EVM on top of the genesis state using provided header as a block context
+func newGenesisEVM(genesis *core.Genesis, statedb *state.StateDB, header *types.Header) *vm.EVM {
+	blockContext := core.NewEVMBlockContext(header, &dummyChainContext{}, &header.Coinbase)
+	txContext := vm.TxContext{Origin: common.Address{}, GasPrice: big.NewInt(0)}
+	// all calls are done with zero gas price, so base fee must be ignored
+	return vm.NewEVM(blockContext, txContext, statedb, genesis.Config, vm.Config{NoBaseFee: true})
+}
+
+// initSystemContracts calls init function for every system contract, it's what consensus engine does in the first block
+func initSystemContracts(evm *vm.EVM, gasLimit uint64) error {
+	for _, contract := range systemContracts {
+		if evm.StateDB.GetCodeSize(contract) == 0 {
+			return fmt.Errorf("system contract is not deployed: %s", contract.Hex())
+		}
+		// genesis with bootstrap calls stores already initialized system contracts
+		initialized, err := viewCall(evm, contract, "isInitialized()(bool)")
+		if err != nil {
+			return err
+		} else if initialized[0].(bool) {
+			continue
+		}
+		result, _, err := evm.Call(vm.AccountRef(common.Address{}), contract, initFunctionSelector, gasLimit, big.NewInt(0))
+		if err != nil {
+			return fmt.Errorf("failed to init system contract (%s): %s", contract.Hex(), formatCallError(result, err))
+		}
+	}
+	return nil
+}
+
+// formatCallError extracts revert reason from the call result if it exists
+func formatCallError(result []byte, err error) string {
+	if reason, unpackErr := abi.UnpackRevert(result); unpackErr == nil {
+		return fmt.Sprintf("%s (%s)", err, reason)
+	}
+	return err.Error()
+}
+
+// viewCall executes read-only call using human-readable method signature and returns unpacked results
+func viewCall(evm *vm.EVM, contract common.Address, signature string, args ...interface{}) ([]interface{}, error) {
+	method, err := parseMethodSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	input, err := method.Inputs.Pack(args...)
+	if err != nil {
+		return nil, err
+	}
+	return viewCallRaw(evm, contract, method, append(method.ID, input...))
+}
+
+func viewCallRaw(evm *vm.EVM, contract common.Address, method abi.Method, input []byte) ([]interface{}, error) {
+	result, _, err := evm.StaticCall(vm.AccountRef(common.Address{}), contract, input, defaultSystemContractGasLimit)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %s", method.Sig, formatCallError(result, err))
+	}
+	return method.Outputs.Unpack(result)
+}
+
+type genesisVerifier struct {
+	config genesisConfig
+	evm    *vm.EVM
+	silent bool
+}
+
+func (v *genesisVerifier) expect(name string, expected, actual interface{}) error {
+	expectedValue, actualValue := formatValues([]interface{}{expected}), formatValues([]interface{}{actual})
+	if expectedValue != actualValue {
+		return fmt.Errorf("invariant violated (%s): expected %s, got %s", name, expectedValue, actualValue)
+	}
+	if !v.silent {
+		fmt.Printf(" + verified: %s = %s\n", name, actualValue)
+	}
+	return nil
+}
+
+func (v *genesisVerifier) verifyStaking() error {
+	initialStakeTotal := big.NewInt(0)
+	for _, validator := range v.config.Validators {
+		initialStake, err := parseInitialStake(v.config, validator)
+		if err != nil {
+			return err
+		}
+		initialStakeTotal.Add(initialStakeTotal, initialStake)
+		status, err := viewCall(v.evm, stakingAddress, "getValidatorStatus(address)(address,uint8,uint256,uint32,uint64,uint64,uint64,uint16,uint96)", validator)
+		if err != nil {
+			return err
+		}
+		if err := v.expect(fmt.Sprintf("validator %s owner", validator.Hex()), validator, status[0]); err != nil {
+			return err
+		}
+		if err := v.expect(fmt.Sprintf("validator %s status", validator.Hex()), uint8(1), status[1]); err != nil {
+			return err
+		}
+		if err := v.expect(fmt.Sprintf("validator %s stake", validator.Hex()), initialStake, status[2]); err != nil {
+			return err
+		}
+		if err := v.expect(fmt.Sprintf("validator %s commission rate", validator.Hex()), uint16(v.config.CommissionRate), status[7]); err != nil {
+			return err
+		}
+	}
+	if err := v.expect("staking balance", initialStakeTotal, v.evm.StateDB.GetBalance(stakingAddress)); err != nil {
+		return err
+	}
+	activeValidators, err := viewCall(v.evm, stakingAddress, "getValidators()(address[])")
+	if err != nil {
+		return err
+	}
+	expectedActive := len(v.config.Validators)
+	if limit := int(v.config.ConsensusParams.ActiveValidatorsLength); expectedActive > limit {
+		expectedActive = limit
+	}
+	return v.expect("active validators", expectedActive, len(activeValidators[0].([]common.Address)))
+}
+
+func (v *genesisVerifier) verifyChainConfig() error {
+	params := v.config.ConsensusParams
+	getters := []struct {
+		signature string
+		expected  interface{}
+	}{
+		{"getActiveValidatorsLength()(uint32)", params.ActiveValidatorsLength},
+		{"getEpochBlockInterval()(uint32)", params.EpochBlockInterval},
+		{"getMisdemeanorThreshold()(uint32)", params.MisdemeanorThreshold},
+		{"getFelonyThreshold()(uint32)", params.FelonyThreshold},
+		{"getValidatorJailEpochLength()(uint32)", params.ValidatorJailEpochLength},
+		{"getUndelegatePeriod()(uint32)", params.UndelegatePeriod},
+		{"getMinValidatorStakeAmount()(uint256)", decimalToBigInt(params.MinValidatorStakeAmount)},
+		{"getMinStakingAmount()(uint256)", decimalToBigInt(params.MinStakingAmount)},
+	}
+	for _, getter := range getters {
+		result, err := viewCall(v.evm, chainConfigAddress, getter.signature)
+		if err != nil {
+			return err
+		}
+		if err := v.expect("chain config "+getter.signature, getter.expected, result[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *genesisVerifier) verifyDeployers() error {
+	for _, deployer := range v.config.Deployers {
+		result, err := viewCall(v.evm, deployerProxyAddress, "isDeployer(address)(bool)", deployer)
+		if err != nil {
+			return err
+		}
+		if err := v.expect(fmt.Sprintf("deployer %s", deployer.Hex()), true, result[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *genesisVerifier) verifyExpectations() error {
+	for i, expectation := range v.config.Expectations {
+		name := expectation.Name
+		if name == "" {
+			name = fmt.Sprintf("expectation #%d (%s)", i, expectation.Method)
+		}
+		method, input, err := packMethodCall(expectation.Method, expectation.Args)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		expected, err := decodeArguments(method.Outputs, expectation.Result)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		actual, err := viewCallRaw(v.evm, expectation.To, method, input)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if formatValues(expected) != formatValues(actual) {
+			return fmt.Errorf("expectation failed (%s): expected [%s], got [%s]", name, formatValues(expected), formatValues(actual))
+		}
+		if !v.silent {
+			fmt.Printf(" + verified: %s = [%s]\n", name, formatValues(actual))
+		}
+	}
+	return nil
+}
+
+// newInitializedGenesisState initializes generated state the same way as consensus engine does,
+// the state is used for verification and bootstrap calls
+func newInitializedGenesisState(genesis *core.Genesis, gasLimit uint64) (*state.StateDB, *vm.EVM, error) {
+	statedb, err := newGenesisState(genesis)
+	if err != nil {
+		return nil, nil, err
+	}
+	evm := newGenesisEVM(genesis, statedb, genesis.ToBlock().Header())
+	if err := initSystemContracts(evm, gasLimit); err != nil {
+		return nil, nil, err
+	}
+	return statedb, evm, nil
+}
+
+// verifyGenesisInvariants checks that system contracts hold configured values
+func verifyGenesisInvariants(evm *vm.EVM, config genesisConfig, silent bool) error {
+	verifier := &genesisVerifier{config: config, evm: evm, silent: silent}
+	for _, verify := range []func() error{
+		verifier.verifyStaking,
+		verifier.verifyChainConfig,
+		verifier.verifyDeployers,
+	} {
+		if err := verify(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyGenesisExpectations checks user-defined expectations, they must hold for the final state
+func verifyGenesisExpectations(evm *vm.EVM, config genesisConfig, silent bool) error {
+	verifier := &genesisVerifier{config: config, evm: evm, silent: silent}
+	return verifier.verifyExpectations()
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Governance overrides _hashTypedDataV4, its domain doesn't depend on the EIP712 initializer, so generic
+// tools that read eip712Domain produce invalid signatures
+const governanceDomainName = "Chiliz Governance"
+const governanceDomainVersion = "1"
+
+var eip712DomainTypeHash = crypto.Keccak256Hash([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"))
+var ballotTypeHash = crypto.Keccak256Hash([]byte("Ballot(uint256 proposalId,uint8 support)"))
+
+// ballotDigest returns typed data digest signed for castVoteBySig
+func ballotDigest(chainId, proposalId *big.Int, support uint8) (common.Hash, error) {
+	domain, err := newArguments("bytes32", "bytes32", "bytes32", "uint256", "address").Pack(
+		[32]byte(eip712DomainTypeHash),
+		[32]byte(crypto.Keccak256Hash([]byte(governanceDomainName))),
+		[32]byte(crypto.Keccak256Hash([]byte(governanceDomainVersion))),
+		chainId,
+		governanceAddress,
+	)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	ballot, err := newArguments("bytes32", "uint256", "uint8").Pack([32]byte(ballotTypeHash), proposalId, support)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash([]byte("\x19\x01"), crypto.Keccak256(domain), crypto.Keccak256(ballot)), nil
+}
+
+// checkGovernanceDomain compares EIP-712 domain of the deployed Governance with the one ballotDigest is built for,
+// castVoteBySig recovers another signer on mismatch and the vote is silently lost
+func checkGovernanceDomain(ctx context.Context, u *runtimeUpgrader) error {
+	name, err := u.call(ctx, common.Address{}, governanceAddress, "name()(string)")
+	if err != nil {
+		return err
+	}
+	version, err := u.call(ctx, common.Address{}, governanceAddress, "version()(string)")
+	if err != nil {
+		return err
+	}
+	if name[0].(string) != governanceDomainName || version[0].(string) != governanceDomainVersion {
+		return fmt.Errorf("governance domain is %q (version %q), but votes are signed for %q (version %q)", name[0], version[0], governanceDomainName, governanceDomainVersion)
+	}
+	return nil
+}
+
+// voteSignature is a castVoteBySig signature of the validator owner
+type voteSignature struct {
+	Voter   common.Address `json:"voter"`
+	Support uint8          `json:"support"`
+	V       uint8          `json:"v"`
+	R       common.Hash    `json:"r"`
+	S       common.Hash    `json:"s"`
+}
+
+// voteBundle collects signatures of several validator owners for the same proposal
+type voteBundle struct {
+	ChainId    *math.HexOrDecimal256 `json:"chainId"`
+	ProposalId *math.HexOrDecimal256 `json:"proposalId"`
+	Votes      []voteSignature       `json:"votes"`
+}
+
+// verify recovers signer of every vote, so a bundle with foreign or broken signatures isn't relayed
+func (b *voteBundle) verify() error {
+	for _, vote := range b.Votes {
+		digest, err := ballotDigest((*big.Int)(b.ChainId), (*big.Int)(b.ProposalId), vote.Support)
+		if err != nil {
+			return err
+		}
+		if vote.V < 27 {
+			return fmt.Errorf("bad signature of %s: v=%d", vote.Voter.Hex(), vote.V)
+		}
+		signature := append(append(append([]byte{}, vote.R[:]...), vote.S[:]...), vote.V-27)
+		publicKey, err := crypto.SigToPub(digest[:], signature)
+		if err != nil {
+			return fmt.Errorf("bad signature of %s: %w", vote.Voter.Hex(), err)
+		}
+		if signer := crypto.PubkeyToAddress(*publicKey); signer != vote.Voter {
+			return fmt.Errorf("signature of %s is made by %s", vote.Voter.Hex(), signer.Hex())
+		}
+	}
+	return nil
+}
+
+// add replaces previous vote of the same voter
+func (b *voteBundle) add(votes ...voteSignature) {
+	for _, vote := range votes {
+		replaced := false
+		for i := range b.Votes {
+			if b.Votes[i].Voter == vote.Voter {
+				b.Votes[i], replaced = vote, true
+			}
+		}
+		if !replaced {
+			b.Votes = append(b.Votes, vote)
+		}
+	}
+	sort.Slice(b.Votes, func(i, j int) bool {
+		return bytes.Compare(b.Votes[i].Voter[:], b.Votes[j].Voter[:]) < 0
+	})
+}
+
+func readVoteBundle(path string) (*voteBundle, error) {
+	fileContents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &voteBundle{}
+	if err := json.Unmarshal(fileContents, bundle); err != nil {
+		return nil, err
+	}
+	if bundle.ChainId == nil || bundle.ProposalId == nil {
+		return nil, fmt.Errorf("vote bundle (%s) doesn't have chain id or proposal id", path)
+	}
+	return bundle, bundle.verify()
+}
+
+func writeVoteBundle(bundle *voteBundle, path string) error {
+	newJson, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, newJson, fs.ModePerm)
+}
+
+// signVotes signs ballot with every requested keystore key and adds signatures into the bundle (it's
+// created if doesn't exist)
+func signVotes(args []string) error {
+	flags := flag.NewFlagSet("vote sign", flag.ExitOnError)
+	keystoreDir := flags.String("keystore", "./keystore", "keystore directory with validator owner keys")
+	passwordFile := flags.String("password", "./password.txt", "password file for the keystore")
+	chainId := flags.Uint64("chain-id", 0, "chain id")
+	proposal := flags.String("proposal", "", "proposal id (decimal or hex)")
+	support := flags.Uint("support", 1, "vote type (0 - against, 1 - for, 2 - abstain)")
+	var voters pathList
+	flags.Var(&voters, "from", "validator owner address (can be repeated)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 || len(voters) == 0 {
+		return fmt.Errorf("usage: vote sign --from ADDRESS [--from ADDRESS] --proposal ID --chain-id ID [--support N] <bundle.json>")
+	}
+	if *support > 2 {
+		return fmt.Errorf("bad vote type: %d", *support)
+	}
+	bundle := &voteBundle{}
+	if _, err := os.Stat(flags.Arg(0)); err == nil {
+		if bundle, err = readVoteBundle(flags.Arg(0)); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if bundle.ChainId == nil {
+		proposalId, ok := math.ParseBig256(*proposal)
+		if !ok || *chainId == 0 {
+			return fmt.Errorf("new bundle requires --proposal and --chain-id")
+		}
+		bundle.ChainId, bundle.ProposalId = (*math.HexOrDecimal256)(new(big.Int).SetUint64(*chainId)), (*math.HexOrDecimal256)(proposalId)
+	} else if proposalId, ok := math.ParseBig256(*proposal); ok && proposalId.Cmp((*big.Int)(bundle.ProposalId)) != 0 {
+		return fmt.Errorf("bundle is made for another proposal (%s)", (*big.Int)(bundle.ProposalId))
+	}
+	digest, err := ballotDigest((*big.Int)(bundle.ChainId), (*big.Int)(bundle.ProposalId), uint8(*support))
+	if err != nil {
+		return err
+	}
+	password, err := readPasswordFile(*passwordFile)
+	if err != nil {
+		return err
+	}
+	ks := keystore.NewKeyStore(*keystoreDir, keystore.StandardScryptN, keystore.StandardScryptP)
+	for _, voter := range voters {
+		if !common.IsHexAddress(voter) {
+			return fmt.Errorf("bad voter address: %s", voter)
+		}
+		account := accounts.Account{Address: common.HexToAddress(voter)}
+		if !ks.HasAddress(account.Address) {
+			return fmt.Errorf("keystore doesn't have key of %s", account.Address.Hex())
+		}
+		signature, err := ks.SignHashWithPassphrase(account, password, digest[:])
+		if err != nil {
+			return err
+		}
+		bundle.add(voteSignature{
+			Voter:   account.Address,
+			Support: uint8(*support),
+			V:       signature[64] + 27,
+			R:       common.BytesToHash(signature[:32]),
+			S:       common.BytesToHash(signature[32:64]),
+		})
+		fmt.Printf(" + signed: voter=%s proposal=%s digest=%s\n", account.Address.Hex(), (*big.Int)(bundle.ProposalId), digest.Hex())
+	}
+	return writeVoteBundle(bundle, flags.Arg(0))
+}
+
+// mergeVotes merges bundles signed on different machines (cold keys) into one
+func mergeVotes(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: vote merge <output.json> <bundle.json> [bundle.json...]")
+	}
+	var result *voteBundle
+	for _, path := range args[1:] {
+		bundle, err := readVoteBundle(path)
+		if err != nil {
+			return err
+		}
+		if result == nil {
+			result = &voteBundle{ChainId: bundle.ChainId, ProposalId: bundle.ProposalId}
+		} else if (*big.Int)(bundle.ChainId).Cmp((*big.Int)(result.ChainId)) != 0 || (*big.Int)(bundle.ProposalId).Cmp((*big.Int)(result.ProposalId)) != 0 {
+			return fmt.Errorf("bundle (%s) is made for another proposal or chain", path)
+		}
+		result.add(bundle.Votes...)
+	}
+	return writeVoteBundle(result, args[0])
+}
+
+// relayVotes submits bundle signatures as castVoteBySig transactions paid by the relayer, votes that are
+// already counted are skipped
+func relayVotes(args []string) error {
+	flags := flag.NewFlagSet("vote relay", flag.ExitOnError)
+	defaultRpc := os.Getenv("WEB3_URL")
+	if defaultRpc == "" {
+		defaultRpc = "http://127.0.0.1:8545"
+	}
+	rpcUrl := flags.String("rpc", defaultRpc, "node RPC endpoint (WEB3_URL by default)")
+	keystoreDir := flags.String("keystore", "./keystore", "keystore directory with the relayer key")
+	passwordFile := flags.String("password", "./password.txt", "password file for the keystore")
+	from := flags.String("from", "", "relayer address")
+	gasPrice := flags.Uint64("gas-price", 0, "gas price in wei (suggested by the node if zero)")
+	poll := flags.Duration("poll", 3*time.Second, "interval of receipt polling")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 || !common.IsHexAddress(*from) {
+		return fmt.Errorf("usage: vote relay --from RELAYER [--rpc URL] <bundle.json>")
+	}
+	bundle, err := readVoteBundle(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	backend, err := ethclient.DialContext(ctx, *rpcUrl)
+	if err != nil {
+		return err
+	}
+	chainId, err := backend.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+	if chainId.Cmp((*big.Int)(bundle.ChainId)) != 0 {
+		return fmt.Errorf("bundle is signed for chain %s, but node is %s", (*big.Int)(bundle.ChainId), chainId)
+	}
+	password, err := readPasswordFile(*passwordFile)
+	if err != nil {
+		return err
+	}
+	relayer := accounts.Account{Address: common.HexToAddress(*from)}
+	ks := keystore.NewKeyStore(*keystoreDir, keystore.StandardScryptN, keystore.StandardScryptP)
+	if err := ks.Unlock(relayer, password); err != nil {
+		return fmt.Errorf("failed to unlock relayer %s: %w", relayer.Address.Hex(), err)
+	}
+	sender := &runtimeUpgrader{backend: backend, ks: ks, chainId: chainId, wait: pollEvery(*poll)}
+	if *gasPrice > 0 {
+		sender.gasPrice = new(big.Int).SetUint64(*gasPrice)
+	}
+	if err := checkGovernanceDomain(ctx, sender); err != nil {
+		return err
+	}
+	proposalId := (*big.Int)(bundle.ProposalId)
+	if state, exists, err := sender.proposalState(ctx, proposalId); err != nil {
+		return err
+	} else if !exists || state != proposalStateActive {
+		return fmt.Errorf("proposal %s is not active", proposalId)
+	}
+	for _, vote := range bundle.Votes {
+		validator, err := sender.call(ctx, common.Address{}, stakingAddress, "getValidatorByOwner(address)(address)", vote.Voter)
+		if err != nil {
+			return err
+		}
+		voted, err := sender.call(ctx, common.Address{}, governanceAddress, "hasVoted(uint256,address)(bool)", proposalId, validator[0])
+		if err != nil {
+			return err
+		}
+		if voted[0].(bool) {
+			fmt.Printf(" ~ %s has already voted\n", vote.Voter.Hex())
+			continue
+		}
+		if err := sender.sendTransaction(ctx, relayer.Address, governanceAddress, "castVoteBySig(uint256,uint8,uint8,bytes32,bytes32)", proposalId, vote.Support, vote.V, [32]byte(vote.R), [32]byte(vote.S)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printBallotDigest prints the digest, so it can be signed by external signers (hardware wallets)
+func printBallotDigest(args []string) error {
+	flags := flag.NewFlagSet("vote digest", flag.ExitOnError)
+	chainId := flags.Uint64("chain-id", 0, "chain id")
+	proposal := flags.String("proposal", "", "proposal id (decimal or hex)")
+	support := flags.Uint("support", 1, "vote type (0 - against, 1 - for, 2 - abstain)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	proposalId, ok := math.ParseBig256(*proposal)
+	if !ok || *chainId == 0 || *support > 2 {
+		return fmt.Errorf("usage: vote digest --proposal ID --chain-id ID [--support N]")
+	}
+	digest, err := ballotDigest(new(big.Int).SetUint64(*chainId), proposalId, uint8(*support))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", digest.Hex())
+	return nil
+}
+
+// runVoteCommand dispatches vote-by-signature subcommands
+func runVoteCommand(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: vote <digest|sign|merge|relay> ...")
+	}
+	switch args[0] {
+	case "digest":
+		return printBallotDigest(args[1:])
+	case "sign":
+		return signVotes(args[1:])
+	case "merge":
+		return mergeVotes(args[1:])
+	case "relay":
+		return relayVotes(args[1:])
+	}
+	return fmt.Errorf("unknown vote command: %s", args[0])
+}
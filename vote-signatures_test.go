@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+func TestBallotDigestTypedData(t *testing.T) {
+	chainId, proposalId := big.NewInt(88882), new(big.Int).Lsh(big.NewInt(0xabcdef), 200)
+	digest, err := ballotDigest(chainId, proposalId, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same ballot hashed by the generic EIP-712 encoder
+	expected, _, err := apitypes.TypedDataAndHash(apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"Ballot": {
+				{Name: "proposalId", Type: "uint256"},
+				{Name: "support", Type: "uint8"},
+			},
+		},
+		PrimaryType: "Ballot",
+		Domain: apitypes.TypedDataDomain{
+			Name:              governanceDomainName,
+			Version:           governanceDomainVersion,
+			ChainId:           (*math.HexOrDecimal256)(chainId),
+			VerifyingContract: governanceAddress.Hex(),
+		},
+		Message: apitypes.TypedDataMessage{
+			"proposalId": proposalId,
+			"support":    big.NewInt(2),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(digest[:], expected) {
+		t.Fatalf("digest mismatch: %s != %x", digest.Hex(), expected)
+	}
+}
+
+func TestCastVoteBySig(t *testing.T) {
+	ctx := context.Background()
+	upgrader, backend, owner := newTestUpgrader(t)
+	// digest is built from constants, so they must match the domain of the deployed contract
+	if err := checkGovernanceDomain(ctx, upgrader); err != nil {
+		t.Fatal(err)
+	}
+	targets, values, calldatas := []common.Address{chainConfigAddress}, []*big.Int{big.NewInt(0)}, [][]byte{{}}
+	description := "vote by signature"
+	if err := upgrader.sendTransaction(ctx, owner, governanceAddress, "propose(address[],uint256[],bytes[],string)", targets, values, calldatas, description); err != nil {
+		t.Fatal(err)
+	}
+	result, err := upgrader.call(ctx, common.Address{}, governanceAddress, "hashProposal(address[],uint256[],bytes[],bytes32)(uint256)", targets, values, calldatas, [32]byte(crypto.Keccak256Hash([]byte(description))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposalId := result[0].(*big.Int)
+	backend.Commit()
+	if state, exists, err := upgrader.proposalState(ctx, proposalId); err != nil {
+		t.Fatal(err)
+	} else if !exists || state != proposalStateActive {
+		t.Fatalf("proposal is %s", proposalStates[state])
+	}
+	// signature is made by the key directly, the contract must recover the validator owner from it
+	key, err := crypto.HexToECDSA(testValidatorKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := ballotDigest(upgrader.chainId, proposalId, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := crypto.Sign(digest[:], key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := &voteBundle{ChainId: (*math.HexOrDecimal256)(upgrader.chainId), ProposalId: (*math.HexOrDecimal256)(proposalId)}
+	bundle.add(voteSignature{Voter: owner, Support: 1, V: signature[64] + 27, R: common.BytesToHash(signature[:32]), S: common.BytesToHash(signature[32:64])})
+	if err := bundle.verify(); err != nil {
+		t.Fatal(err)
+	}
+	vote := bundle.Votes[0]
+	if err := upgrader.sendTransaction(ctx, owner, governanceAddress, "castVoteBySig(uint256,uint8,uint8,bytes32,bytes32)", proposalId, vote.Support, vote.V, [32]byte(vote.R), [32]byte(vote.S)); err != nil {
+		t.Fatal(err)
+	}
+	validator, err := upgrader.call(ctx, common.Address{}, stakingAddress, "getValidatorByOwner(address)(address)", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	voted, err := upgrader.call(ctx, common.Address{}, governanceAddress, "hasVoted(uint256,address)(bool)", proposalId, validator[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !voted[0].(bool) {
+		t.Fatalf("vote of %s isn't counted", owner.Hex())
+	}
+}